@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arthurgustin/openbuzz/orm"
+	"github.com/arthurgustin/openbuzz/shared"
+)
+
+type contextKey int
+
+const apiKeyContextKey contextKey = iota
+
+// Authenticator checks the api keys sent in the Authorization header ("Bearer <key>") or in the
+// X-Api-Key header
+type Authenticator struct {
+	Client interface {
+		FindApiKey(secret string) (orm.ApiKey, error)
+		GetCrawlQuota(key orm.ApiKey) (orm.CrawlQuota, error)
+	} `inject:""`
+	Logger shared.LoggerInterface `inject:""`
+	Config *shared.AppConfig      `inject:""`
+}
+
+// ApiKeyFromContext returns the key which authenticated the request, there is none when the
+// authentication is disabled
+func ApiKeyFromContext(ctx context.Context) (orm.ApiKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey).(orm.ApiKey)
+	return key, ok
+}
+
+// Middleware rejects the requests without a valid api key and stores the key in the request context
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.Config.AuthDisabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		secret := apiKeyFromRequest(r)
+		if secret == "" {
+			writeUnauthorized(w, "an api key is required")
+			return
+		}
+		key, err := a.Client.FindApiKey(secret)
+		if err == orm.ErrApiKeyNotFound {
+			a.Logger.Warn("invalid api key", "remote", r.RemoteAddr)
+			writeUnauthorized(w, "invalid api key")
+			return
+		}
+		if err != nil {
+			writeError(w, err.Error())
+			return
+		}
+
+		if key.DailyCrawlQuota > 0 {
+			quota, err := a.Client.GetCrawlQuota(key)
+			if err != nil {
+				writeError(w, err.Error())
+				return
+			}
+			writeQuotaHeaders(w, quota)
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey, key)))
+	})
+}
+
+// Require only lets through the requests authenticated with a key having the scope
+func (a *Authenticator) Require(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.Config.AuthDisabled {
+			key, ok := ApiKeyFromContext(r.Context())
+			if !ok || !key.HasScope(scope) {
+				writeForbidden(w, fmt.Sprintf("the api key needs the %s scope", scope))
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+func apiKeyFromRequest(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return strings.TrimSpace(r.Header.Get("X-Api-Key"))
+}
+
+func writeQuotaHeaders(w http.ResponseWriter, quota orm.CrawlQuota) {
+	w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", quota.Limit))
+	w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", quota.Remaining()))
+	w.Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", quota.Reset.Unix()))
+}
+
+func writeUnauthorized(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	w.WriteHeader(http.StatusUnauthorized)
+	writeJson(w, data)
+}
+
+func writeForbidden(w http.ResponseWriter, data interface{}) {
+	w.WriteHeader(http.StatusForbidden)
+	writeJson(w, data)
+}
+
+// consumeCrawlQuota counts n urls in the daily quota of the key of the request, it writes the
+// response and returns false when the quota is exceeded
+func (c *CrawlerHandler) consumeCrawlQuota(w http.ResponseWriter, r *http.Request, n int) bool {
+	key, ok := ApiKeyFromContext(r.Context())
+	if !ok || key.DailyCrawlQuota <= 0 {
+		return true
+	}
+
+	quota, allowed, err := c.Client.ConsumeCrawlQuota(key, n)
+	if err != nil {
+		writeError(w, err.Error())
+		return false
+	}
+	writeQuotaHeaders(w, quota)
+	if !allowed {
+		c.Logger.Warn("daily crawl quota exceeded", "keyId", key.KeyID, "requested", fmt.Sprintf("%d", n))
+		writeTooManyRequests(w, quota.Reset.Sub(time.Now()),
+			fmt.Sprintf("the daily crawl quota is exceeded, %d urls can still be crawled today", quota.Remaining()))
+		return false
+	}
+	return true
+}
+
+// refundCrawlQuota gives back the n urls counted by consumeCrawlQuota when they could not be queued
+func (c *CrawlerHandler) refundCrawlQuota(r *http.Request, n int) {
+	key, ok := ApiKeyFromContext(r.Context())
+	if !ok || key.DailyCrawlQuota <= 0 {
+		return
+	}
+	if err := c.Client.RefundCrawlQuota(key, n); err != nil {
+		c.Logger.Warn("unable to refund the crawl quota", "keyId", key.KeyID, "err", err.Error())
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/arthurgustin/openbuzz/orm"
+	"github.com/gorilla/mux"
+)
+
+type JsonCrawlChange struct {
+	Type     string `json:"type"`
+	Field    string `json:"field"`
+	OldValue string `json:"oldValue,omitempty"`
+	NewValue string `json:"newValue,omitempty"`
+}
+
+type JsonCrawlReport struct {
+	ID         string            `json:"id"`
+	JobID      string            `json:"jobId"`
+	CreatedAt  time.Time         `json:"createdAt"`
+	FirstCrawl bool              `json:"firstCrawl"`
+	Partial    bool              `json:"partial"`
+	Changes    []JsonCrawlChange `json:"changes"`
+}
+
+type CrawlReportsResponse struct {
+	Reports []JsonCrawlReport `json:"reports"`
+	Total   int               `json:"total"`
+	Limit   int               `json:"limit"`
+	Offset  int               `json:"offset"`
+	Error   bool              `json:"error"`
+}
+
+// CrawlReports lists what the crawls changed on a prospect, most recent first
+func (c *ProspectHandler) CrawlReports(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	prospectId := vars["prospectId"]
+	query := r.URL.Query()
+
+	limit, err := intParam(query.Get("limit"), defaultPageSize)
+	if err != nil || limit < 1 || limit > maxPageSize {
+		writeError(w, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+		return
+	}
+	offset, err := intParam(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		writeError(w, "offset must be a positive number")
+		return
+	}
+	changedOnly, err := boolParam(query.Get("changedOnly"))
+	if err != nil {
+		writeError(w, "changedOnly must be a boolean")
+		return
+	}
+
+	reports, total, err := c.Client.GetCrawlReports(prospectId, changedOnly, limit, offset)
+	if err == orm.ErrProspectNotFound {
+		writeNotFound(w, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	resp := CrawlReportsResponse{
+		Reports: []JsonCrawlReport{},
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+	}
+	for _, report := range reports {
+		jsonReport := JsonCrawlReport{
+			ID:         report.ReportID,
+			JobID:      report.JobID,
+			CreatedAt:  report.CreatedAt,
+			FirstCrawl: report.FirstCrawl,
+			Partial:    report.Partial,
+			Changes:    []JsonCrawlChange{},
+		}
+		for _, change := range report.Changes {
+			jsonReport.Changes = append(jsonReport.Changes, JsonCrawlChange{
+				Type:     change.Type,
+				Field:    change.Field,
+				OldValue: change.OldValue,
+				NewValue: change.NewValue,
+			})
+		}
+		resp.Reports = append(resp.Reports, jsonReport)
+	}
+
+	writeSuccess(w, resp)
+}
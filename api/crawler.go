@@ -2,23 +2,98 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/arthurgustin/openbuzz/crawler"
+	"github.com/arthurgustin/openbuzz/orm"
 	"github.com/arthurgustin/openbuzz/shared"
+	"github.com/gorilla/mux"
 	"net/http"
-	"sync"
+	"reflect"
 	"time"
 )
 
 type CrawlerHandler struct {
-	Crawler interface {
-		CrawlWebsite(input crawler.CrawlInputInformations) (crawler.CrawlResponse, error)
+	Client interface {
+		CreateCrawlJob(targets []orm.CrawlTarget) (orm.CrawlJob, error)
+		GetCrawlJob(jobId string) (orm.CrawlJob, error)
+		AcknowledgeCrawlJob(jobId string) error
+		CrawlBacklog() (orm.CrawlBacklog, error)
+		ConsumeCrawlQuota(key orm.ApiKey, n int) (orm.CrawlQuota, bool, error)
+		RefundCrawlQuota(key orm.ApiKey, n int) error
+		CrawlTargetsOf(prospectIds []string) ([]orm.CrawlTarget, error)
+	} `inject:""`
+	EventBus interface {
+		Subscribe(jobId string) (events chan crawler.Event, unsubscribe func())
 	} `inject:""`
 	Logger shared.LoggerInterface `inject:""`
+	Config *shared.AppConfig      `inject:""`
 }
 
 type requestCrawl struct {
-	TargetUrls []string `json:"targetUrls"`
+	TargetUrls []crawlTarget `json:"targetUrls"`
+}
+
+// crawlTarget is either a plain url or an object with what we already know about the website
+type crawlTarget struct {
+	Url        string       `json:"url"`
+	FirstName  string       `json:"firstName"`
+	MiddleName string       `json:"middleName"`
+	LastName   string       `json:"lastName"`
+	Options    crawlOptions `json:"options"`
+}
+
+type crawlOptions struct {
+	MaxDepth int `json:"maxDepth"`
+	// TimeBudget is in seconds
+	TimeBudget  int   `json:"timeBudget"`
+	GuessEmails *bool `json:"guessEmails"`
+}
+
+func (t *crawlTarget) UnmarshalJSON(data []byte) error {
+	var url string
+	if err := json.Unmarshal(data, &url); err == nil {
+		*t = crawlTarget{Url: url}
+		return nil
+	}
+
+	// the alias prevents UnmarshalJSON from calling itself
+	type target crawlTarget
+	return json.Unmarshal(data, (*target)(t))
+}
+
+func (t crawlTarget) openApiSchema(g *schemaGenerator) map[string]interface{} {
+	return map[string]interface{}{
+		"oneOf": []interface{}{
+			map[string]interface{}{"type": "string", "format": "uri"},
+			g.object(reflect.TypeOf(t), true),
+		},
+	}
+}
+
+func (t crawlTarget) validate() error {
+	if t.Url == "" {
+		return errors.New("url cannot be empty")
+	}
+	if t.Options.MaxDepth < 0 {
+		return fmt.Errorf("%s: maxDepth cannot be negative", t.Url)
+	}
+	if t.Options.TimeBudget < 0 {
+		return fmt.Errorf("%s: timeBudget cannot be negative", t.Url)
+	}
+	return nil
+}
+
+func (t crawlTarget) toOrm() orm.CrawlTarget {
+	return orm.CrawlTarget{
+		Url:               t.Url,
+		FirstName:         t.FirstName,
+		MiddleName:        t.MiddleName,
+		LastName:          t.LastName,
+		MaxDepth:          t.Options.MaxDepth,
+		TimeBudget:        time.Duration(t.Options.TimeBudget) * time.Second,
+		SkipEmailGuessing: t.Options.GuessEmails != nil && !*t.Options.GuessEmails,
+	}
 }
 
 func writeError(w http.ResponseWriter, data interface{}) {
@@ -31,6 +106,22 @@ func writeSuccess(w http.ResponseWriter, data interface{}) {
 	writeJson(w, data)
 }
 
+func writeNotFound(w http.ResponseWriter, data interface{}) {
+	w.WriteHeader(http.StatusNotFound)
+	writeJson(w, data)
+}
+
+func writeConflict(w http.ResponseWriter, data interface{}) {
+	w.WriteHeader(http.StatusConflict)
+	writeJson(w, data)
+}
+
+func writeTooManyRequests(w http.ResponseWriter, retryAfter time.Duration, data interface{}) {
+	w.Header().Set("Retry-After", fmt.Sprintf("%.0f", retryAfter.Seconds()))
+	w.WriteHeader(http.StatusTooManyRequests)
+	writeJson(w, data)
+}
+
 func writeAccepted(w http.ResponseWriter, data interface{}) {
 	w.WriteHeader(http.StatusAccepted)
 	writeJson(w, data)
@@ -45,12 +136,12 @@ func writeJson(w http.ResponseWriter, data interface{}) {
 }
 
 func (c *CrawlerHandler) CrawlWebsite(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
 	c.Logger.Info("new incoming crawling request")
 	target := requestCrawl{}
 	dec := json.NewDecoder(r.Body)
 	if err := dec.Decode(&target); err != nil {
 		writeError(w, err.Error())
+		return
 	}
 
 	if len(target.TargetUrls) < 1 {
@@ -58,68 +149,241 @@ func (c *CrawlerHandler) CrawlWebsite(w http.ResponseWriter, r *http.Request) {
 		writeError(w, "no urls provided")
 		return
 	}
-	c.Logger.Info(fmt.Sprintf("I started crawling %d websites, come back in a couple of minutes", len(target.TargetUrls)))
 
-	resp := c._crawl(w, start, target)
+	if !c.checkBacklog(w, len(target.TargetUrls)) {
+		return
+	}
 
-	writeSuccess(w, resp)
+	targets := []orm.CrawlTarget{}
+	for _, t := range target.TargetUrls {
+		if err := t.validate(); err != nil {
+			writeError(w, err.Error())
+			return
+		}
+		targets = append(targets, t.toOrm())
+	}
+
+	if !c.consumeCrawlQuota(w, r, len(targets)) {
+		return
+	}
+
+	job, err := c.Client.CreateCrawlJob(targets)
+	if err != nil {
+		c.refundCrawlQuota(r, len(targets))
+		writeError(w, err.Error())
+		return
+	}
+	c.Logger.Info(fmt.Sprintf("I queued %d websites, come back in a couple of minutes", len(target.TargetUrls)), "jobId", job.JobID)
+
+	writeAccepted(w, c.toApiCrawlResponse(job))
+
+	return
+}
+
+// checkBacklog writes a 429 and returns false when the queue cannot accept n more urls
+func (c *CrawlerHandler) checkBacklog(w http.ResponseWriter, n int) bool {
+	if c.Config.CrawlMaxBacklog <= 0 {
+		return true
+	}
+
+	backlog, err := c.Client.CrawlBacklog()
+	if err != nil {
+		writeError(w, err.Error())
+		return false
+	}
+	if backlog.Queued+n > c.Config.CrawlMaxBacklog {
+		c.Logger.Warn("crawl queue is full", "queued", fmt.Sprintf("%d", backlog.Queued))
+		writeTooManyRequests(w, time.Minute, "too many crawls are waiting, retry later")
+		return false
+	}
+	return true
+}
+
+func (c *CrawlerHandler) GetCrawlJob(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	jobId := vars["jobId"]
+
+	job, err := c.Client.GetCrawlJob(jobId)
+	if err == orm.ErrCrawlJobNotFound {
+		writeNotFound(w, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	writeSuccess(w, c.toApiCrawlResponse(job))
+
+	return
+}
+
+func (c *CrawlerHandler) AcknowledgeCrawlJob(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	jobId := vars["jobId"]
+	c.Logger.Info("acknowledge", "jobId", jobId)
+
+	err := c.Client.AcknowledgeCrawlJob(jobId)
+	if err == orm.ErrCrawlJobNotFound {
+		writeNotFound(w, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	w.WriteHeader(200)
+
+	return
+}
+
+// StreamEvents sends the progress of a crawl job as server-sent events until every url is crawled
+func (c *CrawlerHandler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	jobId := vars["jobId"]
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, "streaming is not supported")
+		return
+	}
+
+	// Subscribe before reading the job so that no event is lost in between
+	events, unsubscribe := c.EventBus.Subscribe(jobId)
+	defer unsubscribe()
+
+	job, err := c.Client.GetCrawlJob(jobId)
+	if err == orm.ErrCrawlJobNotFound {
+		writeNotFound(w, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(200)
+
+	writeEvent(w, "status", c.toApiCrawlResponse(job))
+	flusher.Flush()
+	if job.IsFinished() {
+		return
+	}
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e := <-events:
+			writeEvent(w, e.Type, e)
+			if e.Type == crawler.EventCrawlFinished || e.Type == crawler.EventCrawlFailed {
+				if job, err = c.Client.GetCrawlJob(jobId); err != nil {
+					c.Logger.Warn(err.Error(), "jobId", jobId)
+					return
+				}
+				writeEvent(w, "status", c.toApiCrawlResponse(job))
+				if job.IsFinished() {
+					flusher.Flush()
+					return
+				}
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event string, data interface{}) {
+	toWrite, err := json.Marshal(data)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, toWrite)
+}
+
+type apiCrawlBacklog struct {
+	Queued  int `json:"queued"`
+	Running int `json:"running"`
+}
+
+func (c *CrawlerHandler) Backlog(w http.ResponseWriter, r *http.Request) {
+	backlog, err := c.Client.CrawlBacklog()
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	writeSuccess(w, apiCrawlBacklog{
+		Queued:  backlog.Queued,
+		Running: backlog.Running,
+	})
 
 	return
 }
 
 type apiCrawlResponse struct {
+	JobID           string        `json:"jobId"`
+	Finished        bool          `json:"finished"`
 	NumberOfSuccess int64         `json:"numberOfSuccess"`
 	NumberOfFails   int64         `json:"numberOfFails"`
+	NumberOfPending int64         `json:"numberOfPending"`
 	Details         []crawlDetail `json:"details"`
 }
 
 type crawlDetail struct {
-	Url    string `json:"url"`
-	Reason string `json:"reason"`
-	Error  bool   `json:"error"`
-}
-
-func (c *CrawlerHandler) _crawl(w http.ResponseWriter, start time.Time, target requestCrawl) (resp apiCrawlResponse) {
-	var wg sync.WaitGroup
-	wg.Add(len(target.TargetUrls))
-
-	details := make([]crawlDetail, len(target.TargetUrls))
-
-	for i, targetUrl := range target.TargetUrls {
-		go func(url string) {
-			defer wg.Done()
-
-			c.Logger.Info(fmt.Sprintf("crawling %s", url))
-			_, err := c.Crawler.CrawlWebsite(crawler.CrawlInputInformations{
-				TargetUrl: url,
-			})
-			if err != nil {
-				c.Logger.Warn(err.Error())
-				details[i] = crawlDetail{
-					Error:  true,
-					Url:    url,
-					Reason: err.Error(),
-				}
+	Url        string     `json:"url"`
+	State      string     `json:"state"`
+	Reason     string     `json:"reason"`
+	Error      bool       `json:"error"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Elapsed    string     `json:"elapsed,omitempty"`
+	// Result is only set once the url has been crawled successfully
+	Result *crawler.CrawlResponse `json:"result,omitempty"`
+}
+
+func (c *CrawlerHandler) toApiCrawlResponse(job orm.CrawlJob) (resp apiCrawlResponse) {
+	resp.JobID = job.JobID
+	resp.Finished = job.IsFinished()
+	resp.Details = []crawlDetail{}
+
+	for _, item := range job.Items {
+		detail := crawlDetail{
+			Url:        item.Url,
+			State:      item.State,
+			Reason:     item.Reason,
+			Error:      item.State == orm.CrawlStateFailed,
+			StartedAt:  item.StartedAt,
+			FinishedAt: item.FinishedAt,
+		}
+		if item.StartedAt != nil && item.FinishedAt != nil {
+			detail.Elapsed = item.FinishedAt.Sub(*item.StartedAt).String()
+		}
+		if item.Result != "" {
+			result := &crawler.CrawlResponse{}
+			if err := json.Unmarshal([]byte(item.Result), result); err != nil {
+				c.Logger.Warn("unable to decode the crawl result", "jobId", job.JobID, "url", item.Url, "err", err.Error())
 			} else {
-				details[i] = crawlDetail{
-					Error: false,
-					Url:   url,
-				}
+				detail.Result = result
 			}
-			c.Logger.Info(fmt.Sprintf("%s has been crawled", url))
-		}(targetUrl)
-	}
-	wg.Wait()
-	t := time.Now()
-	elapsed := t.Sub(start)
-	c.Logger.Info(fmt.Sprintf("DONE: %d websites. Elapsed: %s", len(target.TargetUrls), elapsed.String()))
+		}
+		resp.Details = append(resp.Details, detail)
 
-	resp.Details = details
-	for _, d := range details {
-		if d.Error {
-			resp.NumberOfFails += 1
-		} else {
+		switch item.State {
+		case orm.CrawlStateDone:
 			resp.NumberOfSuccess += 1
+		case orm.CrawlStateFailed:
+			resp.NumberOfFails += 1
+		default:
+			resp.NumberOfPending += 1
 		}
 	}
 
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/arthurgustin/openbuzz/orm"
+)
+
+const exportPageSize = 500
+
+// csvColumn extracts one cell of the csv export from a prospect
+type csvColumn struct {
+	name  string
+	value func(p orm.ProspectDetails) string
+}
+
+func csvColumns() []csvColumn {
+	columns := []csvColumn{
+		{"url", func(p orm.ProspectDetails) string { return p.GetUrl() }},
+		{"domain", func(p orm.ProspectDetails) string { return p.GetDomain() }},
+		{"firstName", func(p orm.ProspectDetails) string { return p.GetFirstName() }},
+		{"middleName", func(p orm.ProspectDetails) string { return p.GetMiddleName() }},
+		{"lastName", func(p orm.ProspectDetails) string { return p.GetLastName() }},
+		{"description", func(p orm.ProspectDetails) string { return p.Description }},
+		{"bestEmail", func(p orm.ProspectDetails) string {
+			if email, found := bestEmail(p.Emails); found {
+				return email.Email
+			}
+			return ""
+		}},
+		{"bestEmailConfidence", func(p orm.ProspectDetails) string {
+			if email, found := bestEmail(p.Emails); found {
+				return fmt.Sprintf("%.2f", email.Confidence)
+			}
+			return ""
+		}},
+		{"emails", func(p orm.ProspectDetails) string {
+			emails := []string{}
+			for _, email := range p.Emails {
+				emails = append(emails, email.Email)
+			}
+			return strings.Join(emails, ", ")
+		}},
+	}
+
+	for _, name := range orm.AllSocialMedia() {
+		socialMedia := name
+		columns = append(columns, csvColumn{socialMedia, func(p orm.ProspectDetails) string {
+			for _, sm := range p.SocialMedia {
+				if sm.Name == socialMedia {
+					return sm.Url
+				}
+			}
+			return ""
+		}})
+	}
+
+	return append(columns,
+		csvColumn{"tags", func(p orm.ProspectDetails) string {
+			tags := []string{}
+			for _, tag := range p.Tags {
+				tags = append(tags, string(tag))
+			}
+			return strings.Join(tags, ", ")
+		}},
+		csvColumn{"icon", func(p orm.ProspectDetails) string {
+			if len(p.Assets.Icons) > 0 {
+				return p.Assets.Icons[0].Link
+			}
+			return ""
+		}},
+	)
+}
+
+// bestEmail returns the email validated by a user or the one with the highest confidence
+func bestEmail(emails []orm.Email) (best orm.Email, found bool) {
+	for _, email := range emails {
+		if !found ||
+			(email.ValidatedByUser && !best.ValidatedByUser) ||
+			(email.ValidatedByUser == best.ValidatedByUser && email.Confidence > best.Confidence) {
+			best, found = email, true
+		}
+	}
+	return
+}
+
+// selectCsvColumns keeps the requested columns in the requested order, all of them by default
+func selectCsvColumns(names string) ([]csvColumn, error) {
+	all := csvColumns()
+	if names == "" {
+		return all, nil
+	}
+
+	selected := []csvColumn{}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, column := range all {
+			if column.name == name {
+				selected = append(selected, column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %s", name)
+		}
+	}
+	return selected, nil
+}
+
+func csvDelimiter(name string) (rune, error) {
+	switch name {
+	case "", "comma", ",":
+		return ',', nil
+	case "semicolon", ";":
+		return ';', nil
+	case "tab", "\t":
+		return '\t', nil
+	}
+	return 0, fmt.Errorf("delimiter must be comma, semicolon or tab")
+}
+
+// escapeCsvFormula prefixes the values a spreadsheet would run as a formula, e.g a description
+// starting with =HYPERLINK(...) found on a website
+func escapeCsvFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// ExportCsv writes one line per prospect matching the filters of the list. Without limit every
+// matching prospect is exported.
+func (c *ProspectHandler) ExportCsv(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	opts, err := parseListOptions(r)
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+	exportAll := query.Get("limit") == ""
+	if exportAll {
+		opts.Limit = exportPageSize
+	}
+
+	columns, err := selectCsvColumns(query.Get("columns"))
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+	delimiter, err := csvDelimiter(query.Get("delimiter"))
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+	bom, err := boolParam(query.Get("bom"))
+	if err != nil {
+		writeError(w, "bom: "+err.Error())
+		return
+	}
+
+	// Read the first page before writing anything so that errors can still be reported
+	prospects, total, err := c.Client.ListDetailed(opts)
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="prospects.csv"`)
+	w.WriteHeader(200)
+
+	if bom {
+		// Excel needs it to read utf-8
+		w.Write([]byte("\xEF\xBB\xBF"))
+	}
+	writer := csv.NewWriter(w)
+	writer.Comma = delimiter
+
+	header := []string{}
+	for _, column := range columns {
+		header = append(header, column.name)
+	}
+	writer.Write(header)
+
+	c.exportPages(opts, exportAll, prospects, total, func(p orm.ProspectDetails) {
+		row := []string{}
+		for _, column := range columns {
+			row = append(row, escapeCsvFormula(column.value(p)))
+		}
+		writer.Write(row)
+	})
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		c.Logger.Warn("unable to write the csv export", "err", err.Error())
+	}
+}
+
+// exportPages calls export for every prospect of the first page and, when exportAll is set, of the
+// following pages. Errors can't be reported to the client anymore as the response has started.
+func (c *ProspectHandler) exportPages(opts orm.ListOptions, exportAll bool, prospects []orm.ProspectDetails, total int, export func(p orm.ProspectDetails)) {
+	var err error
+	for {
+		for _, p := range prospects {
+			export(p)
+		}
+
+		opts.Offset += opts.Limit
+		if !exportAll || opts.Offset >= total {
+			return
+		}
+		if prospects, _, err = c.Client.ListDetailed(opts); err != nil {
+			c.Logger.Warn("export interrupted", "err", err.Error())
+			return
+		}
+	}
+}
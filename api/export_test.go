@@ -0,0 +1,29 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCsvDelimiter(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		expected rune
+	}{
+		{"", ','},
+		{"comma", ','},
+		{",", ','},
+		{"semicolon", ';'},
+		{";", ';'},
+		{"tab", '\t'},
+		{"\t", '\t'},
+	} {
+		delimiter, err := csvDelimiter(test.name)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.expected, delimiter, test.name)
+	}
+
+	_, err := csvDelimiter("pipe")
+	assert.EqualError(t, err, "delimiter must be comma, semicolon or tab")
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arthurgustin/openbuzz/orm"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// parseListOptions reads the pagination, filters and sort of a prospect listing from the query string
+func parseListOptions(r *http.Request) (opts orm.ListOptions, err error) {
+	query := r.URL.Query()
+
+	if opts.Limit, err = intParam(query.Get("limit"), defaultPageSize); err != nil {
+		return opts, fmt.Errorf("limit: %s", err.Error())
+	}
+	if opts.Limit < 1 || opts.Limit > maxPageSize {
+		return opts, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+	}
+	if opts.Offset, err = intParam(query.Get("offset"), 0); err != nil {
+		return opts, fmt.Errorf("offset: %s", err.Error())
+	}
+	if opts.Offset < 0 {
+		return opts, fmt.Errorf("offset cannot be negative")
+	}
+
+	if opts.HasEmail, err = boolParam(query.Get("hasEmail")); err != nil {
+		return opts, fmt.Errorf("hasEmail: %s", err.Error())
+	}
+	if v := query.Get("minEmailConfidence"); v != "" {
+		if opts.MinEmailConfidence, err = strconv.ParseFloat(v, 64); err != nil {
+			return opts, fmt.Errorf("minEmailConfidence: %s", err.Error())
+		}
+	}
+	opts.Tag = query.Get("tag")
+	opts.SocialNetwork = query.Get("socialNetwork")
+	opts.Domain = query.Get("domain")
+	if opts.CreatedAfter, err = timeParam(query.Get("createdAfter")); err != nil {
+		return opts, fmt.Errorf("createdAfter: %s", err.Error())
+	}
+	if opts.CreatedBefore, err = timeParam(query.Get("createdBefore")); err != nil {
+		return opts, fmt.Errorf("createdBefore: %s", err.Error())
+	}
+	if opts.ValidatedOnly, err = boolParam(query.Get("validatedOnly")); err != nil {
+		return opts, fmt.Errorf("validatedOnly: %s", err.Error())
+	}
+
+	opts.SortBy = query.Get("sort")
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		opts.SortDesc = true
+	default:
+		return opts, fmt.Errorf("order must be asc or desc")
+	}
+
+	return opts, opts.Validate()
+}
+
+func intParam(v string, defaultValue int) (int, error) {
+	if v == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(v)
+}
+
+func boolParam(v string) (bool, error) {
+	if v == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(v)
+}
+
+// timeParam accepts RFC 3339 dates, e.g 2017-10-31T00:00:00Z, or simple dates, e.g 2017-10-31
+func timeParam(v string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		if t, err = time.Parse("2006-01-02", v); err != nil {
+			return nil, err
+		}
+	}
+	return &t, nil
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/arthurgustin/openbuzz/orm"
+	"github.com/gorilla/mux"
+)
+
+type JsonActor struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type JsonHistoryEntry struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	InfoID    uint      `json:"infoId,omitempty"`
+	Action    string    `json:"action"`
+	Field     string    `json:"field,omitempty"`
+	OldValue  string    `json:"oldValue,omitempty"`
+	NewValue  string    `json:"newValue,omitempty"`
+	Actor     JsonActor `json:"actor"`
+}
+
+type HistoryResponse struct {
+	History []JsonHistoryEntry `json:"history"`
+	Total   int                `json:"total"`
+	Limit   int                `json:"limit"`
+	Offset  int                `json:"offset"`
+	Error   bool               `json:"error"`
+}
+
+// as returns the client recording the changes as done by the api key of the request
+func (c *ProspectHandler) as(r *http.Request) orm.Writer {
+	return c.Client.WithActor(actorOf(r))
+}
+
+func actorOf(r *http.Request) orm.Actor {
+	if key, ok := ApiKeyFromContext(r.Context()); ok {
+		return orm.Actor{
+			Type: orm.ActorApiKey,
+			ID:   key.KeyID,
+			Name: key.Name,
+		}
+	}
+	// the authentication is disabled
+	return orm.Actor{Type: orm.ActorUser}
+}
+
+// History lists the changes of a prospect, most recent first
+func (c *ProspectHandler) History(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	prospectId := vars["prospectId"]
+	query := r.URL.Query()
+
+	limit, err := intParam(query.Get("limit"), defaultPageSize)
+	if err != nil || limit < 1 || limit > maxPageSize {
+		writeError(w, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+		return
+	}
+	offset, err := intParam(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		writeError(w, "offset must be a positive number")
+		return
+	}
+
+	entries, total, err := c.Client.GetHistory(prospectId, limit, offset)
+	if err == orm.ErrProspectNotFound {
+		writeNotFound(w, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	resp := HistoryResponse{
+		History: []JsonHistoryEntry{},
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+	}
+	for _, entry := range entries {
+		resp.History = append(resp.History, JsonHistoryEntry{
+			ID:        entry.ID,
+			CreatedAt: entry.CreatedAt,
+			InfoID:    entry.InfoID,
+			Action:    entry.Action,
+			Field:     entry.Field,
+			OldValue:  entry.OldValue,
+			NewValue:  entry.NewValue,
+			Actor: JsonActor{
+				Type: entry.Actor.Type,
+				ID:   entry.Actor.ID,
+				Name: entry.Actor.Name,
+			},
+		})
+	}
+
+	writeSuccess(w, resp)
+}
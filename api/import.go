@@ -0,0 +1,119 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/arthurgustin/openbuzz/importer"
+	"github.com/arthurgustin/openbuzz/orm"
+)
+
+const maxImportSize = 10 << 20
+
+type apiImportResponse struct {
+	Job      *apiCrawlResponse `json:"job,omitempty"`
+	Accepted int               `json:"accepted"`
+	Rejected []apiRejectedRow  `json:"rejected"`
+}
+
+type apiRejectedRow struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+// ImportCsv queues a crawl for each line of a csv file, sent either as the "file" field of a
+// multipart form or as the request body
+func (c *CrawlerHandler) ImportCsv(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseImportOptions(r)
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	// the multipart forms are limited too, ParseMultipartForm only limits what is kept in memory
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	var file io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxImportSize); err != nil {
+			writeError(w, err.Error())
+			return
+		}
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			writeError(w, err.Error())
+			return
+		}
+		defer f.Close()
+		file = f
+	}
+
+	rows, rejected, err := importer.Parse(file, opts)
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	resp := apiImportResponse{
+		Accepted: len(rows),
+		Rejected: []apiRejectedRow{},
+	}
+	for _, row := range rejected {
+		resp.Rejected = append(resp.Rejected, apiRejectedRow{
+			Line:   row.Line,
+			Reason: row.Reason,
+		})
+	}
+	if len(rows) == 0 {
+		writeError(w, resp)
+		return
+	}
+
+	if !c.checkBacklog(w, len(rows)) {
+		return
+	}
+
+	targets := []orm.CrawlTarget{}
+	for _, row := range rows {
+		targets = append(targets, row.Target)
+	}
+	if !c.consumeCrawlQuota(w, r, len(targets)) {
+		return
+	}
+	job, err := c.Client.CreateCrawlJob(targets)
+	if err != nil {
+		c.refundCrawlQuota(r, len(targets))
+		writeError(w, err.Error())
+		return
+	}
+	c.Logger.Info(fmt.Sprintf("I queued %d websites from a csv file", len(targets)), "jobId", job.JobID, "rejected", fmt.Sprintf("%d", len(rejected)))
+
+	apiJob := c.toApiCrawlResponse(job)
+	resp.Job = &apiJob
+	writeAccepted(w, resp)
+
+	return
+}
+
+func parseImportOptions(r *http.Request) (opts importer.Options, err error) {
+	query := r.URL.Query()
+
+	opts.Mapping = importer.ColumnMapping{
+		Url:        query.Get("urlColumn"),
+		FirstName:  query.Get("firstNameColumn"),
+		MiddleName: query.Get("middleNameColumn"),
+		LastName:   query.Get("lastNameColumn"),
+	}
+
+	if v := query.Get("header"); v != "" {
+		hasHeader, err := boolParam(v)
+		if err != nil {
+			return opts, fmt.Errorf("header: %s", err.Error())
+		}
+		opts.HasHeader = &hasHeader
+	}
+
+	opts.Delimiter, err = importer.ParseDelimiter(query.Get("delimiter"))
+	return
+}
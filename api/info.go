@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/arthurgustin/openbuzz/orm"
+	"github.com/badoux/checkmail"
+	"github.com/gorilla/mux"
+)
+
+type requestUpdateInfo struct {
+	Value string `json:"value"`
+}
+
+func (c *ProspectHandler) ValidateInfo(w http.ResponseWriter, r *http.Request) {
+	c.changeInfo(w, r, "validate", c.as(r).ValidateInfo)
+}
+
+func (c *ProspectHandler) RejectInfo(w http.ResponseWriter, r *http.Request) {
+	c.changeInfo(w, r, "reject", c.as(r).RejectInfo)
+}
+
+func (c *ProspectHandler) UpdateInfo(w http.ResponseWriter, r *http.Request) {
+	body := requestUpdateInfo{}
+	dec := json.NewDecoder(r.Body)
+	if err := dec.Decode(&body); err != nil {
+		writeError(w, err.Error())
+		return
+	}
+	if body.Value == "" {
+		writeError(w, "value cannot be empty")
+		return
+	}
+
+	c.changeInfo(w, r, "update", func(prospectId string, infoId uint) error {
+		info, err := c.Client.GetInfo(prospectId, infoId)
+		if err != nil {
+			return err
+		}
+		if info.Key == "email" {
+			if err := checkmail.ValidateFormat(body.Value); err != nil {
+				return err
+			}
+		}
+		return c.as(r).UpdateInfoValue(prospectId, infoId, body.Value)
+	})
+}
+
+func (c *ProspectHandler) changeInfo(w http.ResponseWriter, r *http.Request, action string, change func(prospectId string, infoId uint) error) {
+	vars := mux.Vars(r)
+	prospectId := vars["prospectId"]
+	infoId, err := strconv.ParseUint(vars["infoId"], 10, 64)
+	if err != nil {
+		writeError(w, "invalid information id")
+		return
+	}
+	c.Logger.Info(action, "prospectId", prospectId, "infoId", vars["infoId"])
+
+	err = change(prospectId, uint(infoId))
+	if err == orm.ErrInfoNotFound {
+		writeNotFound(w, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	w.WriteHeader(200)
+
+	return
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/arthurgustin/openbuzz/orm"
+	"github.com/gorilla/mux"
+)
+
+type requestMerge struct {
+	// SourceID is the prospect merged into the one of the url
+	SourceID string `json:"sourceId"`
+}
+
+func (c *ProspectHandler) Merge(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	prospectId := vars["prospectId"]
+
+	body := requestMerge{}
+	dec := json.NewDecoder(r.Body)
+	if err := dec.Decode(&body); err != nil {
+		writeError(w, err.Error())
+		return
+	}
+	if body.SourceID == "" {
+		writeError(w, "sourceId cannot be empty")
+		return
+	}
+
+	err := c.as(r).Merge(prospectId, body.SourceID)
+	if err == orm.ErrProspectNotFound {
+		writeNotFound(w, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+	c.Logger.Info("merged", "prospectId", prospectId, "sourceId", body.SourceID)
+
+	c.writeProspect(w, prospectId)
+}
@@ -0,0 +1,358 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Route is an endpoint of the api. The same table registers the routes and generates the OpenAPI
+// document, so the document cannot miss a route nor describe an outdated json type.
+type Route struct {
+	Method  string
+	Path    string
+	Scope   string
+	Summary string
+	Handler http.HandlerFunc
+	Query   []Param
+	// Request is a value of the type of the json body, nil when the body is not json
+	Request interface{}
+	// RequestContentType describes a body which is not json, e.g a csv file
+	RequestContentType string
+	// Status is the status of a successful response, 200 when it is 0
+	Status int
+	// Response is a value of the type of the json response, nil when the response is not json
+	Response interface{}
+	// ResponseContentType describes a response which is not json, e.g a vCard
+	ResponseContentType string
+}
+
+// Param is a query string parameter
+type Param struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+var pathParamRegexp = regexp.MustCompile(`{(\w+)}`)
+
+// OpenApi serves the OpenAPI 3 document of the routes
+type OpenApi struct {
+	Routes []Route
+	// document is generated once, by the first request
+	once     sync.Once
+	document []byte
+	err      error
+}
+
+func (o *OpenApi) Serve(w http.ResponseWriter, r *http.Request) {
+	o.once.Do(func() {
+		o.document, o.err = json.Marshal(NewOpenApiDocument(o.Routes))
+	})
+	if o.err != nil {
+		writeError(w, o.err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(o.document)
+}
+
+// Check fails when a route of the router is not described by the document, e.g a route registered
+// without the table
+func (o *OpenApi) Check(router *mux.Router) error {
+	documented := map[string]bool{}
+	operations := map[string]bool{}
+	for _, route := range o.Routes {
+		documented[route.Method+" "+route.Path] = true
+		if id := operationId(route); operations[id] {
+			return fmt.Errorf("%s %s has the same operation id as another route: %s", route.Method, route.Path, id)
+		} else {
+			operations[id] = true
+		}
+	}
+
+	return router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return fmt.Errorf("%s is registered without method", path)
+		}
+		for _, method := range methods {
+			if !documented[method+" "+path] {
+				return fmt.Errorf("%s %s is missing from the OpenAPI document", method, path)
+			}
+		}
+		return nil
+	})
+}
+
+// NewOpenApiDocument describes the routes, the schemas are generated from the json types
+func NewOpenApiDocument(routes []Route) map[string]interface{} {
+	g := &schemaGenerator{
+		components: map[string]interface{}{},
+		types:      map[string]reflect.Type{},
+	}
+
+	paths := map[string]map[string]interface{}{}
+	for _, route := range routes {
+		if paths[route.Path] == nil {
+			paths[route.Path] = map[string]interface{}{}
+		}
+		paths[route.Path][strings.ToLower(route.Method)] = g.operation(route)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "openbuzz",
+			"version": "v1",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.components,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{
+					"type":   "http",
+					"scheme": "bearer",
+				},
+				"apiKey": map[string]interface{}{
+					"type": "apiKey",
+					"in":   "header",
+					"name": "X-Api-Key",
+				},
+			},
+		},
+		"security": []map[string][]string{
+			{"bearer": {}},
+			{"apiKey": {}},
+		},
+	}
+}
+
+func (g *schemaGenerator) operation(route Route) map[string]interface{} {
+	parameters := []map[string]interface{}{}
+	for _, match := range pathParamRegexp.FindAllStringSubmatch(route.Path, -1) {
+		parameters = append(parameters, map[string]interface{}{
+			"name":     match[1],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "string"},
+		})
+	}
+	for _, param := range route.Query {
+		parameters = append(parameters, map[string]interface{}{
+			"name":        param.Name,
+			"in":          "query",
+			"description": param.Description,
+			"schema":      map[string]interface{}{"type": param.Type},
+		})
+	}
+
+	status := route.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]interface{}{
+		"description": http.StatusText(status),
+	}
+	switch {
+	case route.Response != nil:
+		success["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": g.schema(reflect.TypeOf(route.Response), false),
+			},
+		}
+	case route.ResponseContentType != "":
+		success["content"] = map[string]interface{}{
+			route.ResponseContentType: map[string]interface{}{
+				"schema": map[string]interface{}{"type": "string"},
+			},
+		}
+	}
+
+	op := map[string]interface{}{
+		"summary":     route.Summary,
+		"description": fmt.Sprintf("Requires an api key with the %s scope.", route.Scope),
+		"operationId": operationId(route),
+		"parameters":  parameters,
+		"responses": map[string]interface{}{
+			fmt.Sprintf("%d", status): success,
+			"default": map[string]interface{}{
+				"description": "The request failed, the body usually is a json string explaining why",
+			},
+		},
+		"x-openbuzz-scope": route.Scope,
+	}
+
+	switch {
+	case route.Request != nil:
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": g.schema(reflect.TypeOf(route.Request), true),
+				},
+			},
+		}
+	case route.RequestContentType != "":
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				route.RequestContentType: map[string]interface{}{
+					"schema": map[string]interface{}{"type": "string", "format": "binary"},
+				},
+			},
+		}
+	}
+	return op
+}
+
+// operationId is e.g getProspectVcard for GET /api/v1/prospect/{prospectId}/vcard
+func operationId(route Route) string {
+	id := strings.ToLower(route.Method)
+	for _, part := range strings.Split(strings.TrimPrefix(route.Path, "/api/v1/"), "/") {
+		if strings.HasPrefix(part, "{") {
+			continue
+		}
+		for _, word := range strings.FieldsFunc(part, func(r rune) bool { return r == '.' || r == '-' }) {
+			id += strings.Title(word)
+		}
+	}
+	return id
+}
+
+// schemaDescriber is implemented by the types having a custom json encoding
+type schemaDescriber interface {
+	openApiSchema(g *schemaGenerator) map[string]interface{}
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	schemaDescriberType = reflect.TypeOf((*schemaDescriber)(nil)).Elem()
+)
+
+type schemaGenerator struct {
+	components map[string]interface{}
+	types      map[string]reflect.Type
+}
+
+// schema returns the schema of a type, the structs are stored in the components and referenced.
+// Request schemas have no required fields because the missing fields keep their zero value.
+func (g *schemaGenerator) schema(t reflect.Type, request bool) map[string]interface{} {
+	if t.Kind() != reflect.Ptr && t.Implements(schemaDescriberType) {
+		return reflect.Zero(t).Interface().(schemaDescriber).openApiSchema(g)
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := g.schema(t.Elem(), request)
+		if _, isRef := s["$ref"]; isRef {
+			return map[string]interface{}{"allOf": []interface{}{s}, "nullable": true}
+		}
+		s["nullable"] = true
+		return s
+	case reflect.Struct:
+		if t == timeType {
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		}
+		return g.ref(t, request)
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem(), request)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem(), request)}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	// interface{} accepts anything
+	return map[string]interface{}{}
+}
+
+func (g *schemaGenerator) ref(t reflect.Type, request bool) map[string]interface{} {
+	name := strings.Title(t.Name())
+	if existing, found := g.types[name]; found && existing != t {
+		// the same name in two packages, e.g crawler.Event and another Event
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = strings.Title(pkg) + name
+	}
+	ref := map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	if _, found := g.types[name]; found {
+		return ref
+	}
+
+	// registered before the properties so that recursive types terminate
+	g.types[name] = t
+	g.components[name] = g.object(t, request)
+	return ref
+}
+
+func (g *schemaGenerator) object(t reflect.Type, request bool) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	g.addFields(t, request, properties, &required)
+
+	s := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// addFields follows the rules of encoding/json: the embedded structs are flattened, the unexported
+// and "-" fields are ignored
+func (g *schemaGenerator) addFields(t reflect.Type, request bool, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options := tag, ""
+		if comma := strings.Index(tag, ","); comma >= 0 {
+			name, options = tag[:comma], tag[comma+1:]
+		}
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			g.addFields(field.Type, request, properties, required)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = g.schema(field.Type, request)
+		if !request && !strings.Contains(options, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
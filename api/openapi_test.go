@@ -0,0 +1,168 @@
+package api
+
+import (
+	"encoding/json"
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/openapi.json")
+
+const goldenDocument = "testdata/openapi.json"
+
+func testRoutes() []Route {
+	return Routes(Handlers{
+		Crawler:  &CrawlerHandler{},
+		Prospect: &ProspectHandler{},
+		Webhook:  &WebhookHandler{},
+		OpenApi:  &OpenApi{},
+	})
+}
+
+// TestOpenApiDocument fails when the api changes without the golden document, run
+// go test ./api -update to accept the changes and review them in the diff
+func TestOpenApiDocument(t *testing.T) {
+	document, err := json.MarshalIndent(NewOpenApiDocument(testRoutes()), "", "  ")
+	require.NoError(t, err)
+	document = append(document, '\n')
+
+	if *update {
+		require.NoError(t, ioutil.WriteFile(goldenDocument, document, 0644))
+	}
+	expected, err := ioutil.ReadFile(goldenDocument)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(document), "the api changed, run go test ./api -update")
+}
+
+func TestOpenApiServe(t *testing.T) {
+	o := &OpenApi{Routes: testRoutes()}
+	expected, err := json.Marshal(NewOpenApiDocument(o.Routes))
+	require.NoError(t, err)
+
+	// the first requests generate the document at the same time
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			o.Serve(w, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			assert.Equal(t, string(expected), w.Body.String())
+		}()
+	}
+	wg.Wait()
+}
+
+func TestOpenApiCheck(t *testing.T) {
+	o := &OpenApi{Routes: testRoutes()}
+	router := mux.NewRouter()
+	for _, route := range o.Routes {
+		router.HandleFunc(route.Path, route.Handler).Methods(route.Method)
+	}
+	assert.NoError(t, o.Check(router))
+
+	router.HandleFunc("/api/v1/undocumented", func(w http.ResponseWriter, r *http.Request) {}).Methods(http.MethodGet)
+	assert.EqualError(t, o.Check(router), "GET /api/v1/undocumented is missing from the OpenAPI document")
+}
+
+// TestHandlersDecodeTheirRequest checks that the Request of each route is the type its handler
+// decodes the body into, the document describes the wrong body otherwise
+func TestHandlersDecodeTheirRequest(t *testing.T) {
+	decoded := decodedTypes(t)
+	for _, route := range testRoutes() {
+		expected := ""
+		if route.Request != nil {
+			expected = reflect.TypeOf(route.Request).Name()
+		}
+		name := handlerName(route.Handler)
+		assert.Equal(t, expected, decoded[name], "%s %s is served by %s", route.Method, route.Path, name)
+	}
+}
+
+// handlerName is e.g ProspectHandler.Update
+func handlerName(handler http.HandlerFunc) string {
+	// e.g github.com/arthurgustin/openbuzz/api.(*ProspectHandler).Update-fm
+	name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+	name = strings.TrimPrefix(name[strings.LastIndex(name, "/")+1:], "api.")
+	return strings.NewReplacer("(*", "", ")", "", "-fm", "").Replace(name)
+}
+
+// decodedTypes parses the handlers and returns the type each one decodes the json body into,
+// e.g requestUpdateProspect for ProspectHandler.Update
+func decodedTypes(t *testing.T) map[string]string {
+	files, err := filepath.Glob("*.go")
+	require.NoError(t, err)
+
+	decoded := map[string]string{}
+	fset := token.NewFileSet()
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, nil, 0)
+		require.NoError(t, err)
+
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil || fn.Body == nil {
+				continue
+			}
+			star, ok := fn.Recv.List[0].Type.(*ast.StarExpr)
+			if !ok {
+				continue
+			}
+			receiver, ok := star.X.(*ast.Ident)
+			if !ok {
+				continue
+			}
+
+			// the type of the variables declared as e.g body := requestMerge{}
+			types := map[string]string{}
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.AssignStmt:
+					for i, rhs := range n.Rhs {
+						lit, ok := rhs.(*ast.CompositeLit)
+						if !ok || i >= len(n.Lhs) {
+							continue
+						}
+						typ, isIdent := lit.Type.(*ast.Ident)
+						variable, isVariable := n.Lhs[i].(*ast.Ident)
+						if isIdent && isVariable {
+							types[variable.Name] = typ.Name
+						}
+					}
+				case *ast.CallExpr:
+					sel, ok := n.Fun.(*ast.SelectorExpr)
+					if !ok || sel.Sel.Name != "Decode" || len(n.Args) != 1 {
+						return true
+					}
+					if arg, ok := n.Args[0].(*ast.UnaryExpr); ok {
+						if variable, ok := arg.X.(*ast.Ident); ok {
+							decoded[receiver.Name+"."+fn.Name.Name] = types[variable.Name]
+						}
+					}
+				}
+				return true
+			})
+		}
+	}
+	return decoded
+}
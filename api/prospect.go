@@ -3,40 +3,65 @@ package api
 import (
 	"github.com/arthurgustin/openbuzz/orm"
 	"github.com/arthurgustin/openbuzz/shared"
-	"net/http"
 	"github.com/gorilla/mux"
+	"net/http"
+	"time"
 )
 
 type ProspectHandler struct {
 	Client interface {
-		List() ([]orm.Prospect, error)
-		Delete(prospectId string) (err error)
-		GetEmails(prospectId string) ([]orm.Email, error)
-		GetSocialMedia(prospectId string) (socialMedias []orm.SocialMedia, err error)
-		GetAssets(prospectId string) (orm.Assets, error)
-		GetTags(prospectId string) ([]orm.Tag, error)
-		GetDescription(prospectId string) (string, error)
+		ListDetailed(opts orm.ListOptions) ([]orm.ProspectDetails, int, error)
+		Search(text string, opts orm.ListOptions) ([]orm.SearchResult, int, error)
+		GetDetailed(prospectId string) (orm.ProspectDetails, error)
+		Get(prospectId string) (orm.Prospect, error)
+		GetInfo(prospectId string, infoId uint) (orm.ProspectInfo, error)
+		ListTrash(opts orm.ListOptions) ([]orm.TrashedProspect, int, error)
+		GetHistory(prospectId string, limit, offset int) ([]orm.HistoryEntry, int, error)
+		GetCrawlReports(prospectId string, changedOnly bool, limit, offset int) ([]orm.CrawlReport, int, error)
+		// WithActor gives the client making the changes, they are recorded in the history
+		WithActor(actor orm.Actor) orm.Writer
 	} `inject:""`
 	Logger shared.LoggerInterface `inject:""`
 }
 
 type JsonProspect struct {
-	ProspectID  string              `json:"id"`
-	Host        string              `json:"host"`
-	Description string              `json:"description"`
-	Emails      []JsonProspectEmail `json:"emails"`
-	SocialMedia []JsonSocialMedia   `json:"socialMedia"`
-	Assets      JsonAssets          `json:"assets"`
-	Tags        []JsonTag           `json:"tags"`
+	ProspectID string    `json:"id"`
+	Host       string    `json:"host"`
+	FirstName  string    `json:"firstName"`
+	MiddleName string    `json:"middleName"`
+	LastName   string    `json:"lastName"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	// LastCrawledAt is not set when the website has never been crawled
+	LastCrawledAt *time.Time          `json:"lastCrawledAt,omitempty"`
+	Description   string              `json:"description"`
+	Infos         []JsonProspectInfo  `json:"infos,omitempty"`
+	Emails        []JsonProspectEmail `json:"emails"`
+	SocialMedia   []JsonSocialMedia   `json:"socialMedia"`
+	Assets        JsonAssets          `json:"assets"`
+	Tags          []JsonTag           `json:"tags"`
+}
+
+// JsonProspectInfo is any information of a prospect, they are only listed for a single prospect
+type JsonProspectInfo struct {
+	ID              uint    `json:"id"`
+	Key             string  `json:"key"`
+	Value           string  `json:"value"`
+	Confidence      float64 `json:"confidence"`
+	ValidatedByUser bool    `json:"validatedByUser"`
+	Source          string  `json:"source"`
 }
 
 type JsonProspectEmail struct {
+	ID              uint    `json:"id"`
 	Email           string  `json:"email"`
 	Confidence      float64 `json:"confidence"`
 	ValidatedByUser bool    `json:"validatedByUser"`
+	Source          string  `json:"source"`
 }
 
 type JsonSocialMedia struct {
+	ID              uint    `json:"id"`
 	Name            string  `json:"name"`
 	Link            string  `json:"link"`
 	Confidence      float64 `json:"confidence"`
@@ -55,15 +80,52 @@ type JsonTag string
 
 type Response struct {
 	Prospects []JsonProspect `json:"prospects"`
+	Total     int            `json:"total"`
+	Limit     int            `json:"limit"`
+	Offset    int            `json:"offset"`
 	Error     bool           `json:"error"`
 }
 
+type ProspectResponse struct {
+	Prospect JsonProspect `json:"prospect"`
+	Error    bool         `json:"error"`
+}
+
+func (c *ProspectHandler) Get(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	prospectId := vars["prospectId"]
+
+	p, err := c.Client.GetDetailed(prospectId)
+	if err == orm.ErrProspectNotFound {
+		writeNotFound(w, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	jsonProspect := c.toJsonProspect(p)
+	jsonProspect.Infos = c.ormInfosToJsonInfos(p.Infos)
+
+	writeSuccess(w, ProspectResponse{
+		Error:    false,
+		Prospect: jsonProspect,
+	})
+
+	return
+}
+
 func (c *ProspectHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	prospectId := vars["prospectId"]
 	c.Logger.Info("delete", "prospectId", prospectId)
 
-	err := c.Client.Delete(prospectId)
+	err := c.as(r).Delete(prospectId)
+	if err == orm.ErrProspectNotFound {
+		writeNotFound(w, err.Error())
+		return
+	}
 	if err != nil {
 		writeError(w, err.Error())
 		return
@@ -75,7 +137,13 @@ func (c *ProspectHandler) Delete(w http.ResponseWriter, r *http.Request) {
 }
 
 func (c *ProspectHandler) List(w http.ResponseWriter, r *http.Request) {
-	prospects, err := c.Client.List()
+	opts, err := parseListOptions(r)
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	prospects, total, err := c.Client.ListDetailed(opts)
 	if err != nil {
 		writeError(w, err.Error())
 		return
@@ -84,50 +152,15 @@ func (c *ProspectHandler) List(w http.ResponseWriter, r *http.Request) {
 	result := []JsonProspect{}
 
 	for _, p := range prospects {
-		emails, err := c.Client.GetEmails(p.ProspectId)
-		if err != nil {
-			c.Logger.Warn("unable to get emails for "+p.ProspectId, "err", err.Error())
-			continue
-		}
-
-		socialMedia, err := c.Client.GetSocialMedia(p.ProspectId)
-		if err != nil {
-			c.Logger.Warn("unable to get social media for "+p.ProspectId, "err", err.Error())
-			continue
-		}
-
-		assets, err := c.Client.GetAssets(p.ProspectId)
-		if err != nil {
-			c.Logger.Warn("unable to get social media for "+p.ProspectId, "err", err.Error())
-			continue
-		}
-
-		tags, err := c.Client.GetTags(p.ProspectId)
-		if err != nil {
-			c.Logger.Warn("unable to get tags for "+p.ProspectId, "err", err.Error())
-			continue
-		}
-
-		description, err := c.Client.GetDescription(p.ProspectId)
-		if err != nil {
-			c.Logger.Warn("unable to get description for "+p.ProspectId, "err", err.Error())
-			continue
-		}
-
-		result = append(result, JsonProspect{
-			ProspectID:  p.ProspectId,
-			Host:        p.GetUrl(),
-			Description: description,
-			Emails:      c.ormEmailsToJsonEmails(emails),
-			SocialMedia: c.ormSocialMediaToJsonSocialMedia(socialMedia),
-			Assets:      c.ormAssetsToJsonAssets(assets),
-			Tags:        c.ormTagsToJsonTags(tags),
-		})
+		result = append(result, c.toJsonProspect(p))
 	}
 
 	resp := Response{
 		Error:     false,
 		Prospects: result,
+		Total:     total,
+		Limit:     opts.Limit,
+		Offset:    opts.Offset,
 	}
 
 	writeSuccess(w, resp)
@@ -135,12 +168,46 @@ func (c *ProspectHandler) List(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+func (c *ProspectHandler) toJsonProspect(p orm.ProspectDetails) JsonProspect {
+	return JsonProspect{
+		ProspectID:    p.ProspectId,
+		Host:          p.GetUrl(),
+		FirstName:     p.GetFirstName(),
+		MiddleName:    p.GetMiddleName(),
+		LastName:      p.GetLastName(),
+		CreatedAt:     p.GetCreatedAt(),
+		UpdatedAt:     p.GetUpdatedAt(),
+		LastCrawledAt: p.GetLastCrawledAt(),
+		Description:   p.Description,
+		Emails:        c.ormEmailsToJsonEmails(p.Emails),
+		SocialMedia:   c.ormSocialMediaToJsonSocialMedia(p.SocialMedia),
+		Assets:        c.ormAssetsToJsonAssets(p.Assets),
+		Tags:          c.ormTagsToJsonTags(p.Tags),
+	}
+}
+
+func (c *ProspectHandler) ormInfosToJsonInfos(infos []orm.ProspectInfo) (jsonInfos []JsonProspectInfo) {
+	for _, info := range infos {
+		jsonInfos = append(jsonInfos, JsonProspectInfo{
+			ID:              info.ID,
+			Key:             info.Key,
+			Value:           info.Val,
+			Confidence:      info.Confidence,
+			ValidatedByUser: info.ValidatedByUser,
+			Source:          info.Source,
+		})
+	}
+	return
+}
+
 func (c *ProspectHandler) ormEmailsToJsonEmails(emails []orm.Email) (jsonEmails []JsonProspectEmail) {
 	for _, email := range emails {
 		jsonEmails = append(jsonEmails, JsonProspectEmail{
+			ID:              email.InfoID,
 			Email:           email.Email,
 			ValidatedByUser: email.ValidatedByUser,
 			Confidence:      email.Confidence,
+			Source:          email.Source,
 		})
 	}
 	return
@@ -149,6 +216,7 @@ func (c *ProspectHandler) ormEmailsToJsonEmails(emails []orm.Email) (jsonEmails
 func (c *ProspectHandler) ormSocialMediaToJsonSocialMedia(socialMedia []orm.SocialMedia) (jsonSocialMedia []JsonSocialMedia) {
 	for _, sm := range socialMedia {
 		jsonSocialMedia = append(jsonSocialMedia, JsonSocialMedia{
+			ID:              sm.InfoID,
 			Name:            sm.Name,
 			Link:            sm.Url,
 			ValidatedByUser: sm.ValidatedByUser,
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/arthurgustin/openbuzz/orm"
+	"github.com/badoux/checkmail"
+	"github.com/gorilla/mux"
+)
+
+type requestCreateProspect struct {
+	Url        string `json:"url"`
+	FirstName  string `json:"firstName"`
+	MiddleName string `json:"middleName"`
+	LastName   string `json:"lastName"`
+	requestProspectInfos
+}
+
+// requestProspectInfos are informations entered by hand
+type requestProspectInfos struct {
+	Description string                   `json:"description"`
+	Emails      []string                 `json:"emails"`
+	SocialMedia []requestSocialMediaLink `json:"socialMedia"`
+	Tags        []string                 `json:"tags"`
+}
+
+type requestSocialMediaLink struct {
+	Name string `json:"name"`
+	Link string `json:"link"`
+}
+
+// requestUpdateProspect only changes the fields which are set
+type requestUpdateProspect struct {
+	FirstName   *string              `json:"firstName"`
+	MiddleName  *string              `json:"middleName"`
+	LastName    *string              `json:"lastName"`
+	Description *string              `json:"description"`
+	Add         requestProspectInfos `json:"add"`
+	// Remove contains the ids of the informations to remove
+	Remove []uint `json:"remove"`
+}
+
+func (i requestProspectInfos) validate() error {
+	for _, email := range i.Emails {
+		if err := checkmail.ValidateFormat(email); err != nil {
+			return fmt.Errorf("%s: %s", email, err.Error())
+		}
+	}
+	for _, sm := range i.SocialMedia {
+		if !orm.IsSocialMedia(sm.Name) {
+			return fmt.Errorf("%s: %s", sm.Name, orm.ErrUnknownSocialNetwork.Error())
+		}
+		if err := validateUrl(sm.Link); err != nil {
+			return err
+		}
+	}
+	for _, tag := range i.Tags {
+		if tag == "" {
+			return errors.New("tags cannot be empty")
+		}
+	}
+	return nil
+}
+
+// setOn adds the emails, social media and tags to the prospect, the description is handled by the caller
+func (i requestProspectInfos) setOn(p *orm.Prospect) {
+	for _, email := range i.Emails {
+		p.SetEmail(email, 1)
+	}
+	for _, sm := range i.SocialMedia {
+		p.SetSocial(sm.Name, sm.Link, 1)
+	}
+	for _, tag := range i.Tags {
+		p.SetTag(tag)
+	}
+}
+
+func validateUrl(rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return fmt.Errorf("%s: %s", rawUrl, err.Error())
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s: an absolute http or https url is expected", rawUrl)
+	}
+	return nil
+}
+
+func (c *ProspectHandler) Create(w http.ResponseWriter, r *http.Request) {
+	body := requestCreateProspect{}
+	dec := json.NewDecoder(r.Body)
+	if err := dec.Decode(&body); err != nil {
+		writeError(w, err.Error())
+		return
+	}
+	if err := validateUrl(body.Url); err != nil {
+		writeError(w, err.Error())
+		return
+	}
+	if err := body.validate(); err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	// user provided before the url is set so that the domain is entered by hand too
+	p := new(orm.Prospect).
+		SetUserProvided().
+		SetUrl(body.Url).
+		SetFirstName(body.FirstName).
+		SetMiddleName(body.MiddleName).
+		SetLastName(body.LastName)
+	if body.Description != "" {
+		p.SetDescription(body.Description)
+	}
+	body.setOn(p)
+
+	err := c.as(r).Create(p)
+	if err == orm.ErrProspectAlreadyExists {
+		writeConflict(w, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+	c.Logger.Info("created", "prospectId", p.ProspectId, "url", body.Url)
+
+	c.writeProspect(w, p.ProspectId)
+
+	return
+}
+
+func (c *ProspectHandler) Update(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	prospectId := vars["prospectId"]
+
+	body := requestUpdateProspect{}
+	dec := json.NewDecoder(r.Body)
+	if err := dec.Decode(&body); err != nil {
+		writeError(w, err.Error())
+		return
+	}
+	if err := body.Add.validate(); err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	c.Logger.Info("update", "prospectId", prospectId)
+
+	edit := orm.ProspectEdit{
+		FirstName:  body.FirstName,
+		MiddleName: body.MiddleName,
+		LastName:   body.LastName,
+		Remove:     body.Remove,
+		// without url, the domain of the prospect is not added again
+		Add: new(orm.Prospect).SetUserProvided(),
+	}
+	if body.Description != nil {
+		edit.RemoveKeys = []string{"description"}
+		if *body.Description != "" {
+			edit.Add.SetDescription(*body.Description)
+		}
+	}
+	body.Add.setOn(edit.Add)
+
+	err := c.as(r).Edit(prospectId, edit)
+	if err == orm.ErrProspectNotFound || err == orm.ErrInfoNotFound {
+		writeNotFound(w, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	c.writeProspect(w, prospectId)
+
+	return
+}
+
+func (c *ProspectHandler) writeProspect(w http.ResponseWriter, prospectId string) {
+	p, err := c.Client.GetDetailed(prospectId)
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	jsonProspect := c.toJsonProspect(p)
+	jsonProspect.Infos = c.ormInfosToJsonInfos(p.Infos)
+
+	writeSuccess(w, ProspectResponse{
+		Error:    false,
+		Prospect: jsonProspect,
+	})
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/arthurgustin/openbuzz/orm"
+)
+
+type requestRecrawl struct {
+	ProspectIDs []string `json:"prospectIds"`
+}
+
+// Recrawl queues the websites of known prospects without waiting for their data to be stale
+func (c *CrawlerHandler) Recrawl(w http.ResponseWriter, r *http.Request) {
+	body := requestRecrawl{}
+	dec := json.NewDecoder(r.Body)
+	if err := dec.Decode(&body); err != nil {
+		writeError(w, err.Error())
+		return
+	}
+	if len(body.ProspectIDs) < 1 {
+		writeError(w, "no prospects provided")
+		return
+	}
+
+	targets, err := c.Client.CrawlTargetsOf(body.ProspectIDs)
+	if err == orm.ErrProspectNotFound {
+		writeNotFound(w, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	if !c.checkBacklog(w, len(targets)) || !c.consumeCrawlQuota(w, r, len(targets)) {
+		return
+	}
+
+	job, err := c.Client.CreateCrawlJob(targets)
+	if err != nil {
+		c.refundCrawlQuota(r, len(targets))
+		writeError(w, err.Error())
+		return
+	}
+	c.Logger.Info(fmt.Sprintf("I queued %d prospects to recrawl", len(targets)), "jobId", job.JobID)
+
+	writeAccepted(w, c.toApiCrawlResponse(job))
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/arthurgustin/openbuzz/orm"
+)
+
+// Handlers are the handlers serving the routes
+type Handlers struct {
+	Crawler  *CrawlerHandler
+	Prospect *ProspectHandler
+	Webhook  *WebhookHandler
+	OpenApi  *OpenApi
+}
+
+var (
+	pageParams = []Param{
+		{Name: "limit", Type: "integer", Description: "maximum number of results, 50 by default and 500 at most"},
+		{Name: "offset", Type: "integer", Description: "number of results to skip"},
+	}
+	filterParams = []Param{
+		{Name: "hasEmail", Type: "boolean", Description: "only the prospects having an email"},
+		{Name: "minEmailConfidence", Type: "number", Description: "only the prospects having an email at least this confident, between 0 and 1"},
+		{Name: "tag", Type: "string", Description: "only the prospects having this tag, case insensitive"},
+		{Name: "socialNetwork", Type: "string", Description: "only the prospects having a link to this social network"},
+		{Name: "domain", Type: "string", Description: "only the prospects whose url contains this text"},
+		{Name: "createdAfter", Type: "string", Description: "RFC 3339 date or YYYY-MM-DD"},
+		{Name: "createdBefore", Type: "string", Description: "RFC 3339 date or YYYY-MM-DD"},
+		{Name: "validatedOnly", Type: "boolean", Description: "only the prospects having an information validated by a user"},
+		{Name: "sort", Type: "string", Description: "created (default), updated or emailConfidence"},
+		{Name: "order", Type: "string", Description: "asc (default) or desc"},
+	}
+	searchParams = []Param{
+		{Name: "q", Type: "string", Description: `the words to find, "quoted phrases", OR and -excluded words are supported`},
+	}
+	cardParams = []Param{
+		{Name: "minConfidence", Type: "number", Description: "only the informations at least this confident or validated, 0.8 by default"},
+		{Name: "all", Type: "boolean", Description: "all the informations whatever their confidence"},
+	}
+	csvParams = []Param{
+		{Name: "columns", Type: "string", Description: "comma separated columns, all by default"},
+		{Name: "delimiter", Type: "string", Description: "comma (default), semicolon or tab"},
+		{Name: "bom", Type: "boolean", Description: "start the file with a utf-8 byte order mark for Excel"},
+	}
+	reportParams = []Param{
+		{Name: "changedOnly", Type: "boolean", Description: "skip the crawls which changed nothing"},
+	}
+	importParams = []Param{
+		{Name: "urlColumn", Type: "string", Description: "name or 1-based index of the website column, detected from the header by default"},
+		{Name: "firstNameColumn", Type: "string", Description: "name or 1-based index of the first name column"},
+		{Name: "middleNameColumn", Type: "string", Description: "name or 1-based index of the middle name column"},
+		{Name: "lastNameColumn", Type: "string", Description: "name or 1-based index of the last name column"},
+		{Name: "header", Type: "boolean", Description: "whether the first line is a header, detected by default"},
+		{Name: "delimiter", Type: "string", Description: "comma, semicolon or tab, detected by default"},
+	}
+)
+
+func params(lists ...[]Param) (all []Param) {
+	for _, list := range lists {
+		all = append(all, list...)
+	}
+	return
+}
+
+// Routes lists every endpoint of the api with what the OpenAPI document needs to describe it
+func Routes(h Handlers) []Route {
+	return []Route{
+		{Method: http.MethodPost, Path: "/api/v1/crawl", Scope: orm.ScopeCrawl, Handler: h.Crawler.CrawlWebsite,
+			Summary: "Queue websites to crawl", Request: requestCrawl{}, Status: http.StatusAccepted, Response: apiCrawlResponse{}},
+		{Method: http.MethodPost, Path: "/api/v1/import", Scope: orm.ScopeCrawl, Handler: h.Crawler.ImportCsv,
+			Summary: "Queue the websites of a csv file, sent as the body or as the file field of a multipart form", Query: importParams,
+			RequestContentType: "text/csv", Status: http.StatusAccepted, Response: apiImportResponse{}},
+		{Method: http.MethodGet, Path: "/api/v1/queue", Scope: orm.ScopeRead, Handler: h.Crawler.Backlog,
+			Summary: "Count the websites waiting to be crawled", Response: apiCrawlBacklog{}},
+		{Method: http.MethodGet, Path: "/api/v1/crawl/{jobId}", Scope: orm.ScopeRead, Handler: h.Crawler.GetCrawlJob,
+			Summary: "Get the progress of a crawl job", Response: apiCrawlResponse{}},
+		{Method: http.MethodDelete, Path: "/api/v1/crawl/{jobId}", Scope: orm.ScopeCrawl, Handler: h.Crawler.AcknowledgeCrawlJob,
+			Summary: "Forget a crawl job, the websites still queued are not crawled"},
+		{Method: http.MethodPost, Path: "/api/v1/recrawl", Scope: orm.ScopeCrawl, Handler: h.Crawler.Recrawl,
+			Summary: "Queue the websites of prospects again to refresh their informations", Request: requestRecrawl{}, Status: http.StatusAccepted, Response: apiCrawlResponse{}},
+		{Method: http.MethodGet, Path: "/api/v1/crawl/{jobId}/events", Scope: orm.ScopeRead, Handler: h.Crawler.StreamEvents,
+			Summary: "Follow a crawl job with server-sent events", ResponseContentType: "text/event-stream"},
+		{Method: http.MethodGet, Path: "/api/v1/list", Scope: orm.ScopeRead, Handler: h.Prospect.List,
+			Summary: "List the prospects", Query: params(pageParams, filterParams), Response: Response{}},
+		{Method: http.MethodGet, Path: "/api/v1/search", Scope: orm.ScopeRead, Handler: h.Prospect.Search,
+			Summary: "Search the prospects by url, names, description and tags, the most relevant first", Query: params(searchParams, pageParams, filterParams),
+			Response: SearchResponse{}},
+		{Method: http.MethodGet, Path: "/api/v1/export.csv", Scope: orm.ScopeRead, Handler: h.Prospect.ExportCsv,
+			Summary: "Export the prospects as csv, all the matching prospects when there is no limit", Query: params(pageParams, filterParams, csvParams), ResponseContentType: "text/csv"},
+		{Method: http.MethodGet, Path: "/api/v1/export.vcf", Scope: orm.ScopeRead, Handler: h.Prospect.ExportVCards,
+			Summary: "Export the prospects as vCards, all the matching prospects when there is no limit", Query: params(pageParams, filterParams, cardParams), ResponseContentType: "text/vcard"},
+		{Method: http.MethodPost, Path: "/api/v1/prospect", Scope: orm.ScopeWrite, Handler: h.Prospect.Create,
+			Summary: "Create a prospect by hand", Request: requestCreateProspect{}, Response: ProspectResponse{}},
+		{Method: http.MethodGet, Path: "/api/v1/prospect/{prospectId}", Scope: orm.ScopeRead, Handler: h.Prospect.Get,
+			Summary: "Get a prospect and all its informations", Response: ProspectResponse{}},
+		{Method: http.MethodPatch, Path: "/api/v1/prospect/{prospectId}", Scope: orm.ScopeWrite, Handler: h.Prospect.Update,
+			Summary: "Edit a prospect, only the fields which are set are changed and an information added again is validated", Request: requestUpdateProspect{}, Response: ProspectResponse{}},
+		{Method: http.MethodDelete, Path: "/api/v1/prospect/{prospectId}", Scope: orm.ScopeDelete, Handler: h.Prospect.Delete,
+			Summary: "Move a prospect to the trash"},
+		{Method: http.MethodPost, Path: "/api/v1/prospect/{prospectId}/restore", Scope: orm.ScopeDelete, Handler: h.Prospect.Restore,
+			Summary: "Bring back a prospect from the trash with the informations deleted with it", Response: ProspectResponse{}},
+		{Method: http.MethodPost, Path: "/api/v1/prospect/{prospectId}/merge", Scope: orm.ScopeWrite, Handler: h.Prospect.Merge,
+			Summary: "Merge another prospect into this one, the other one is moved to the trash and its url becomes an alias", Request: requestMerge{}, Response: ProspectResponse{}},
+		{Method: http.MethodGet, Path: "/api/v1/trash", Scope: orm.ScopeRead, Handler: h.Prospect.Trash,
+			Summary: "List the deleted prospects, the most recently deleted first", Query: pageParams, Response: TrashResponse{}},
+		{Method: http.MethodGet, Path: "/api/v1/prospect/{prospectId}/history", Scope: orm.ScopeRead, Handler: h.Prospect.History,
+			Summary: "List the changes of a prospect and who made them, most recent first", Query: pageParams, Response: HistoryResponse{}},
+		{Method: http.MethodGet, Path: "/api/v1/prospect/{prospectId}/crawl-reports", Scope: orm.ScopeRead, Handler: h.Prospect.CrawlReports,
+			Summary: "List what each crawl added, removed or updated on a prospect, most recent first", Query: params(pageParams, reportParams), Response: CrawlReportsResponse{}},
+		{Method: http.MethodGet, Path: "/api/v1/prospect/{prospectId}/vcard", Scope: orm.ScopeRead, Handler: h.Prospect.VCard,
+			Summary: "Get the vCard of a prospect", Query: cardParams, ResponseContentType: "text/vcard"},
+		{Method: http.MethodGet, Path: "/api/v1/prospect/{prospectId}/hcard", Scope: orm.ScopeRead, Handler: h.Prospect.HCard,
+			Summary: "Get the hCard of a prospect", Query: cardParams, ResponseContentType: "text/html"},
+		{Method: http.MethodPatch, Path: "/api/v1/prospect/{prospectId}/info/{infoId}", Scope: orm.ScopeWrite, Handler: h.Prospect.UpdateInfo,
+			Summary: "Correct an information, the corrected value is validated and the wrong one rejected", Request: requestUpdateInfo{}},
+		{Method: http.MethodPost, Path: "/api/v1/prospect/{prospectId}/info/{infoId}/validate", Scope: orm.ScopeWrite, Handler: h.Prospect.ValidateInfo,
+			Summary: "Mark an information as right"},
+		{Method: http.MethodPost, Path: "/api/v1/prospect/{prospectId}/info/{infoId}/reject", Scope: orm.ScopeWrite, Handler: h.Prospect.RejectInfo,
+			Summary: "Hide a wrong information, it won't be added again by the crawler"},
+		{Method: http.MethodPost, Path: "/api/v1/webhooks", Scope: orm.ScopeAdmin, Handler: h.Webhook.Create,
+			Summary: "Subscribe a webhook to events, the secret signing the payloads is only returned here",
+			Request: requestCreateWebhook{}, Status: http.StatusCreated, Response: WebhookResponse{}},
+		{Method: http.MethodGet, Path: "/api/v1/webhooks", Scope: orm.ScopeAdmin, Handler: h.Webhook.List,
+			Summary: "List the webhooks", Response: WebhooksResponse{}},
+		{Method: http.MethodDelete, Path: "/api/v1/webhooks/{webhookId}", Scope: orm.ScopeAdmin, Handler: h.Webhook.Delete,
+			Summary: "Delete a webhook, its pending deliveries are abandoned"},
+		{Method: http.MethodGet, Path: "/api/v1/webhooks/{webhookId}/deliveries", Scope: orm.ScopeAdmin, Handler: h.Webhook.Deliveries,
+			Summary: "List the deliveries of a webhook, most recent first", Query: pageParams, Response: DeliveriesResponse{}},
+		{Method: http.MethodGet, Path: "/api/v1/openapi.json", Scope: orm.ScopeRead, Handler: h.OpenApi.Serve,
+			Summary: "Get this OpenAPI document"},
+	}
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+)
+
+type JsonSearchResult struct {
+	JsonProspect
+	Rank float64 `json:"rank"`
+	// Snippet is html, the matching words are wrapped in <mark> tags
+	Snippet string `json:"snippet"`
+}
+
+type SearchResponse struct {
+	Results []JsonSearchResult `json:"results"`
+	Total   int                `json:"total"`
+	Limit   int                `json:"limit"`
+	Offset  int                `json:"offset"`
+	Error   bool               `json:"error"`
+}
+
+// Search finds the prospects whose url, names, description or tags match q, the list filters
+// narrow the results
+func (c *ProspectHandler) Search(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListOptions(r)
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	results, total, err := c.Client.Search(r.URL.Query().Get("q"), opts)
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	resp := SearchResponse{
+		Results: []JsonSearchResult{},
+		Total:   total,
+		Limit:   opts.Limit,
+		Offset:  opts.Offset,
+	}
+	for _, result := range results {
+		resp.Results = append(resp.Results, JsonSearchResult{
+			JsonProspect: c.toJsonProspect(result.ProspectDetails),
+			Rank:         result.Rank,
+			Snippet:      result.Snippet,
+		})
+	}
+
+	writeSuccess(w, resp)
+}
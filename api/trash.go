@@ -0,0 +1,81 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/arthurgustin/openbuzz/orm"
+	"github.com/gorilla/mux"
+)
+
+type JsonTrashedProspect struct {
+	JsonProspect
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+type TrashResponse struct {
+	Prospects []JsonTrashedProspect `json:"prospects"`
+	Total     int                   `json:"total"`
+	Limit     int                   `json:"limit"`
+	Offset    int                   `json:"offset"`
+	Error     bool                  `json:"error"`
+}
+
+// Trash lists the deleted prospects, the most recently deleted first
+func (c *ProspectHandler) Trash(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	opts := orm.ListOptions{}
+	var err error
+	if opts.Limit, err = intParam(query.Get("limit"), defaultPageSize); err != nil || opts.Limit < 1 || opts.Limit > maxPageSize {
+		writeError(w, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+		return
+	}
+	if opts.Offset, err = intParam(query.Get("offset"), 0); err != nil || opts.Offset < 0 {
+		writeError(w, "offset must be a positive number")
+		return
+	}
+
+	prospects, total, err := c.Client.ListTrash(opts)
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	resp := TrashResponse{
+		Prospects: []JsonTrashedProspect{},
+		Total:     total,
+		Limit:     opts.Limit,
+		Offset:    opts.Offset,
+	}
+	for _, p := range prospects {
+		resp.Prospects = append(resp.Prospects, JsonTrashedProspect{
+			JsonProspect: c.toJsonProspect(p.ProspectDetails),
+			DeletedAt:    p.DeletedAt,
+		})
+	}
+
+	writeSuccess(w, resp)
+}
+
+func (c *ProspectHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	prospectId := vars["prospectId"]
+
+	err := c.as(r).Restore(prospectId)
+	if err == orm.ErrProspectNotFound {
+		writeNotFound(w, "no deleted prospect with this id")
+		return
+	}
+	if err == orm.ErrProspectAlreadyExists {
+		writeConflict(w, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+	c.Logger.Info("restored", "prospectId", prospectId)
+
+	c.writeProspect(w, prospectId)
+}
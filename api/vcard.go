@@ -0,0 +1,275 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/arthurgustin/openbuzz/orm"
+	"github.com/gorilla/mux"
+)
+
+const defaultCardMinConfidence = 0.8
+
+// cardContent is what is exported in a vCard or an hCard, only the trusted informations are kept
+type cardContent struct {
+	ProspectID  string
+	FirstName   string
+	MiddleName  string
+	LastName    string
+	FullName    string
+	Url         string
+	Photo       string
+	Description string
+	Emails      []string
+	SocialMedia []orm.SocialMedia
+	Revision    string
+}
+
+// cardFilter tells which informations are trusted enough to be exported
+type cardFilter struct {
+	minConfidence float64
+	all           bool
+}
+
+func (f cardFilter) keep(confidence float64, validatedByUser bool) bool {
+	return f.all || validatedByUser || confidence >= f.minConfidence
+}
+
+func parseCardFilter(r *http.Request) (f cardFilter, err error) {
+	query := r.URL.Query()
+
+	f.minConfidence = defaultCardMinConfidence
+	if v := query.Get("minConfidence"); v != "" {
+		if f.minConfidence, err = strconv.ParseFloat(v, 64); err != nil {
+			return f, fmt.Errorf("minConfidence: %s", err.Error())
+		}
+	}
+	if f.all, err = boolParam(query.Get("all")); err != nil {
+		return f, fmt.Errorf("all: %s", err.Error())
+	}
+	return
+}
+
+func newCardContent(p orm.ProspectDetails, f cardFilter) cardContent {
+	content := cardContent{
+		ProspectID:  p.ProspectId,
+		FirstName:   strings.Title(p.GetFirstName()),
+		MiddleName:  strings.Title(p.GetMiddleName()),
+		LastName:    strings.Title(p.GetLastName()),
+		Url:         p.GetUrl(),
+		Description: p.Description,
+		Revision:    p.GetUpdatedAt().UTC().Format("20060102T150405Z"),
+	}
+
+	names := []string{}
+	for _, name := range []string{content.FirstName, content.MiddleName, content.LastName} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	content.FullName = strings.Join(names, " ")
+	if content.FullName == "" {
+		content.FullName = p.GetDomain()
+	}
+
+	if best, found := bestEmail(p.Emails); found && f.keep(best.Confidence, best.ValidatedByUser) {
+		content.Emails = append(content.Emails, best.Email)
+	}
+	for _, email := range p.Emails {
+		if email.Email != firstOrEmpty(content.Emails) && f.keep(email.Confidence, email.ValidatedByUser) {
+			content.Emails = append(content.Emails, email.Email)
+		}
+	}
+
+	for _, sm := range p.SocialMedia {
+		if f.keep(sm.Confidence, sm.ValidatedByUser) {
+			content.SocialMedia = append(content.SocialMedia, sm)
+		}
+	}
+
+	if len(p.Assets.Icons) > 0 {
+		content.Photo = p.Assets.Icons[0].Link
+	}
+	return content
+}
+
+func firstOrEmpty(l []string) string {
+	if len(l) == 0 {
+		return ""
+	}
+	return l[0]
+}
+
+// vCard 3.0, the version most address books understand, see RFC 2426
+func (content cardContent) vCard() string {
+	lines := []string{
+		"BEGIN:VCARD",
+		"VERSION:3.0",
+		"UID:" + escapeVCard(content.ProspectID),
+		fmt.Sprintf("N:%s;%s;%s;;", escapeVCard(content.LastName), escapeVCard(content.FirstName), escapeVCard(content.MiddleName)),
+		"FN:" + escapeVCard(content.FullName),
+		"URL:" + vCardUri(content.Url),
+	}
+	for i, email := range content.Emails {
+		if i == 0 {
+			lines = append(lines, "EMAIL;TYPE=INTERNET,PREF:"+escapeVCard(email))
+		} else {
+			lines = append(lines, "EMAIL;TYPE=INTERNET:"+escapeVCard(email))
+		}
+	}
+	for _, sm := range content.SocialMedia {
+		lines = append(lines, fmt.Sprintf("X-SOCIALPROFILE;TYPE=%s:%s", sm.Name, vCardUri(sm.Url)))
+	}
+	if content.Photo != "" {
+		lines = append(lines, "PHOTO;VALUE=URI:"+vCardUri(content.Photo))
+	}
+	if content.Description != "" {
+		lines = append(lines, "NOTE:"+escapeVCard(content.Description))
+	}
+	lines = append(lines, "REV:"+content.Revision, "END:VCARD")
+
+	var b bytes.Buffer
+	for _, line := range lines {
+		b.WriteString(foldVCardLine(line))
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
+
+func escapeVCard(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// vCardUri writes a URI value as it is, the escaping of the TEXT values would break the commas
+// and semicolons of its query string
+func vCardUri(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// foldVCardLine splits the lines longer than 75 octets without breaking utf-8 characters
+func foldVCardLine(line string) string {
+	var b bytes.Buffer
+	length := 0
+	for _, r := range line {
+		size := len(string(r))
+		if length+size > 75 {
+			b.WriteString("\r\n ")
+			length = 1
+		}
+		b.WriteRune(r)
+		length += size
+	}
+	return b.String()
+}
+
+var hCardTemplate = template.Must(template.New("hcard").Parse(`<div class="vcard">
+	<a class="url fn" href="{{.Url}}">{{.FullName}}</a>
+	{{- if or .FirstName .LastName}}
+	<span class="n">
+		<span class="given-name">{{.FirstName}}</span>
+		{{- if .MiddleName}} <span class="additional-name">{{.MiddleName}}</span>{{end}}
+		<span class="family-name">{{.LastName}}</span>
+	</span>
+	{{- end}}
+	{{- range .Emails}}
+	<a class="email" href="mailto:{{.}}">{{.}}</a>
+	{{- end}}
+	{{- range .SocialMedia}}
+	<a class="url" rel="me" href="{{.Url}}">{{.Name}}</a>
+	{{- end}}
+	{{- if .Photo}}
+	<img class="photo" src="{{.Photo}}" alt="{{.FullName}}"/>
+	{{- end}}
+	{{- if .Description}}
+	<p class="note">{{.Description}}</p>
+	{{- end}}
+</div>
+`))
+
+func (c *ProspectHandler) getCardContent(w http.ResponseWriter, r *http.Request) (content cardContent, ok bool) {
+	vars := mux.Vars(r)
+	prospectId := vars["prospectId"]
+
+	f, err := parseCardFilter(r)
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	p, err := c.Client.GetDetailed(prospectId)
+	if err == orm.ErrProspectNotFound {
+		writeNotFound(w, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+	return newCardContent(p, f), true
+}
+
+func (c *ProspectHandler) VCard(w http.ResponseWriter, r *http.Request) {
+	content, ok := c.getCardContent(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/vcard; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.vcf"`, content.ProspectID))
+	w.WriteHeader(200)
+	w.Write([]byte(content.vCard()))
+}
+
+func (c *ProspectHandler) HCard(w http.ResponseWriter, r *http.Request) {
+	content, ok := c.getCardContent(w, r)
+	if !ok {
+		return
+	}
+
+	var b bytes.Buffer
+	if err := hCardTemplate.Execute(&b, content); err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(200)
+	w.Write(b.Bytes())
+}
+
+// ExportVCards writes the vCards of the prospects matching the filters of the list in a single file
+func (c *ProspectHandler) ExportVCards(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListOptions(r)
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+	exportAll := r.URL.Query().Get("limit") == ""
+	if exportAll {
+		opts.Limit = exportPageSize
+	}
+
+	f, err := parseCardFilter(r)
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	prospects, total, err := c.Client.ListDetailed(opts)
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/vcard; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="prospects.vcf"`)
+	w.WriteHeader(200)
+
+	c.exportPages(opts, exportAll, prospects, total, func(p orm.ProspectDetails) {
+		w.Write([]byte(newCardContent(p, f).vCard()))
+	})
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/arthurgustin/openbuzz/orm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVCardEscapesOnlyTheTextValues(t *testing.T) {
+	card := cardContent{
+		ProspectID:  "42",
+		FirstName:   "Alice",
+		LastName:    "Doe",
+		FullName:    "Alice Doe",
+		Url:         "https://korben.info/?a=1,2;b",
+		Photo:       "https://korben.info/icon.png?size=1,2",
+		Description: "blog; news, tech",
+		SocialMedia: []orm.SocialMedia{{Name: "twitter", Url: "https://twitter.com/korben?a=1;b\r\nEND:VCARD"}},
+		Revision:    "20201018T000000Z",
+	}.vCard()
+
+	assert.Contains(t, card, "URL:https://korben.info/?a=1,2;b\r\n")
+	assert.Contains(t, card, "PHOTO;VALUE=URI:https://korben.info/icon.png?size=1,2\r\n")
+	assert.Contains(t, card, "X-SOCIALPROFILE;TYPE=twitter:https://twitter.com/korben?a=1;bEND:VCARD\r\n")
+	assert.Contains(t, card, `NOTE:blog\; news\, tech`)
+	assert.Contains(t, card, "N:Doe;Alice;;;\r\n")
+}
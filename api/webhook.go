@@ -0,0 +1,199 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arthurgustin/openbuzz/orm"
+	"github.com/arthurgustin/openbuzz/shared"
+	"github.com/arthurgustin/openbuzz/webhook"
+	"github.com/gorilla/mux"
+)
+
+type WebhookHandler struct {
+	Client interface {
+		CreateWebhook(url string, events []string) (orm.Webhook, error)
+		ListWebhooks() ([]orm.Webhook, error)
+		GetWebhook(webhookId string) (orm.Webhook, error)
+		DeleteWebhook(webhookId string) error
+		ListWebhookDeliveries(webhookId string, limit, offset int) ([]orm.WebhookDelivery, int, error)
+	} `inject:""`
+	Logger shared.LoggerInterface `inject:""`
+}
+
+type requestCreateWebhook struct {
+	Url    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+func (req requestCreateWebhook) validate() error {
+	if err := validateUrl(req.Url); err != nil {
+		return err
+	}
+	if len(req.Events) == 0 {
+		return errors.New("events cannot be empty")
+	}
+	for _, event := range req.Events {
+		if !webhook.IsEvent(event) {
+			return fmt.Errorf("unknown event %s, expected * or one of %s", event, strings.Join(webhook.AllEvents, ", "))
+		}
+	}
+	return nil
+}
+
+type JsonWebhook struct {
+	WebhookID string   `json:"id"`
+	Url       string   `json:"url"`
+	Events    []string `json:"events"`
+	// Secret is only returned when the webhook is created
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type JsonWebhookDelivery struct {
+	DeliveryID     string     `json:"id"`
+	Event          string     `json:"event"`
+	State          string     `json:"state"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"nextAttemptAt,omitempty"`
+	LastStatusCode int        `json:"lastStatusCode,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	DeliveredAt    *time.Time `json:"deliveredAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	Payload        string     `json:"payload"`
+}
+
+type WebhookResponse struct {
+	Webhook JsonWebhook `json:"webhook"`
+	Error   bool        `json:"error"`
+}
+
+type WebhooksResponse struct {
+	Webhooks []JsonWebhook `json:"webhooks"`
+	Error    bool          `json:"error"`
+}
+
+type DeliveriesResponse struct {
+	Deliveries []JsonWebhookDelivery `json:"deliveries"`
+	Total      int                   `json:"total"`
+	Limit      int                   `json:"limit"`
+	Offset     int                   `json:"offset"`
+	Error      bool                  `json:"error"`
+}
+
+func (c *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	req := requestCreateWebhook{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, err.Error())
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	hook, err := c.Client.CreateWebhook(req.Url, req.Events)
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+	c.Logger.Info("webhook created", "webhookId", hook.WebhookID, "url", hook.Url)
+
+	jsonHook := toJsonWebhook(hook)
+	jsonHook.Secret = hook.Secret
+	w.WriteHeader(http.StatusCreated)
+	writeJson(w, WebhookResponse{Webhook: jsonHook})
+}
+
+func (c *WebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	hooks, err := c.Client.ListWebhooks()
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	res := WebhooksResponse{Webhooks: []JsonWebhook{}}
+	for _, hook := range hooks {
+		res.Webhooks = append(res.Webhooks, toJsonWebhook(hook))
+	}
+	writeSuccess(w, res)
+}
+
+func (c *WebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	webhookId := mux.Vars(r)["webhookId"]
+
+	err := c.Client.DeleteWebhook(webhookId)
+	if err == orm.ErrWebhookNotFound {
+		writeNotFound(w, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+	c.Logger.Info("webhook deleted", "webhookId", webhookId)
+	w.WriteHeader(200)
+}
+
+// Deliveries returns the delivery history of a webhook, most recent first
+func (c *WebhookHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	webhookId := mux.Vars(r)["webhookId"]
+	query := r.URL.Query()
+
+	limit, err := intParam(query.Get("limit"), defaultPageSize)
+	if err != nil || limit < 1 || limit > maxPageSize {
+		writeError(w, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+		return
+	}
+	offset, err := intParam(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		writeError(w, "offset must be a positive number")
+		return
+	}
+
+	if _, err := c.Client.GetWebhook(webhookId); err == orm.ErrWebhookNotFound {
+		writeNotFound(w, err.Error())
+		return
+	}
+
+	deliveries, total, err := c.Client.ListWebhookDeliveries(webhookId, limit, offset)
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+
+	res := DeliveriesResponse{
+		Deliveries: []JsonWebhookDelivery{},
+		Total:      total,
+		Limit:      limit,
+		Offset:     offset,
+	}
+	for _, d := range deliveries {
+		res.Deliveries = append(res.Deliveries, JsonWebhookDelivery{
+			DeliveryID:     d.DeliveryID,
+			Event:          d.Event,
+			State:          d.State,
+			Attempts:       d.Attempts,
+			NextAttemptAt:  d.NextAttemptAt,
+			LastStatusCode: d.LastStatusCode,
+			LastError:      d.LastError,
+			DeliveredAt:    d.DeliveredAt,
+			CreatedAt:      d.CreatedAt,
+			Payload:        d.Payload,
+		})
+	}
+	writeSuccess(w, res)
+}
+
+func toJsonWebhook(hook orm.Webhook) JsonWebhook {
+	return JsonWebhook{
+		WebhookID: hook.WebhookID,
+		Url:       hook.Url,
+		Events:    hook.Events,
+		CreatedAt: hook.CreatedAt,
+	}
+}
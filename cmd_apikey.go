@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+const apikeyUsage = "usage: openbuzz apikey create [options] | list | revoke <key id>"
+
+// apikeyCommand manages the api keys, e.g openbuzz apikey create -name crm -scopes read,crawl -daily-crawl-quota 500
+func apikeyCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, apikeyUsage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "create":
+		createApiKey(args[1:])
+	case "list":
+		listApiKeys()
+	case "revoke":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, apikeyUsage)
+			os.Exit(2)
+		}
+		initDbClient()
+		if err := dbClient.RevokeApiKey(args[1]); err != nil {
+			exitWithError(err)
+		}
+		fmt.Printf("the api key %s is revoked\n", args[1])
+	default:
+		fmt.Fprintln(os.Stderr, apikeyUsage)
+		os.Exit(2)
+	}
+}
+
+func createApiKey(args []string) {
+	flags := flag.NewFlagSet("apikey create", flag.ExitOnError)
+	name := flags.String("name", "", "what the key is used for")
+	scopes := flags.String("scopes", "read", "comma separated scopes among read, write, crawl, delete and admin")
+	quota := flags.Int("daily-crawl-quota", 0, "how many urls the key can queue per day, 0 means no limit")
+	flags.Parse(args)
+
+	if *quota < 0 {
+		exitWithError(fmt.Errorf("daily-crawl-quota cannot be negative"))
+	}
+	scopeList := []string{}
+	for _, scope := range strings.Split(*scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopeList = append(scopeList, scope)
+		}
+	}
+	if len(scopeList) == 0 {
+		exitWithError(fmt.Errorf("at least one scope is required"))
+	}
+
+	initDbClient()
+	key, secret, err := dbClient.CreateApiKey(*name, scopeList, *quota)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	fmt.Printf("api key %s created with the scopes %s\n", key.KeyID, strings.Join(key.Scopes, ", "))
+	fmt.Println("keep it safe, it won't be shown again:")
+	fmt.Println(secret)
+}
+
+func listApiKeys() {
+	initDbClient()
+	keys, err := dbClient.ListApiKeys()
+	if err != nil {
+		exitWithError(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tPREFIX\tSCOPES\tDAILY CRAWL QUOTA\tCREATED")
+	for _, key := range keys {
+		quota := "none"
+		if key.DailyCrawlQuota > 0 {
+			quota = fmt.Sprintf("%d", key.DailyCrawlQuota)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", key.KeyID, key.Name, key.Prefix, strings.Join(key.Scopes, ","), quota, key.CreatedAt.Format("2006-01-02"))
+	}
+	w.Flush()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/arthurgustin/openbuzz/importer"
+	"github.com/arthurgustin/openbuzz/orm"
+	"github.com/facebookgo/inject"
+)
+
+// importCommand queues a crawl for each line of a csv file,
+// e.g openbuzz import -url-column website -first-name-column prenom leads.csv
+func importCommand(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	urlColumn := flags.String("url-column", "", "name or 1-based index of the website column, detected from the header by default")
+	firstNameColumn := flags.String("first-name-column", "", "name or 1-based index of the first name column")
+	middleNameColumn := flags.String("middle-name-column", "", "name or 1-based index of the middle name column")
+	lastNameColumn := flags.String("last-name-column", "", "name or 1-based index of the last name column")
+	header := flags.String("header", "auto", "whether the first line is a header: true, false or auto")
+	delimiter := flags.String("delimiter", "auto", "comma, semicolon, tab or auto")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: openbuzz import [options] file.csv")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	opts := importer.Options{
+		Mapping: importer.ColumnMapping{
+			Url:        *urlColumn,
+			FirstName:  *firstNameColumn,
+			MiddleName: *middleNameColumn,
+			LastName:   *lastNameColumn,
+		},
+	}
+	switch *header {
+	case "auto":
+	case "true", "false":
+		hasHeader := *header == "true"
+		opts.HasHeader = &hasHeader
+	default:
+		exitWithError(fmt.Errorf("header must be true, false or auto"))
+	}
+	var err error
+	if opts.Delimiter, err = importer.ParseDelimiter(*delimiter); err != nil {
+		exitWithError(err)
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		exitWithError(err)
+	}
+	defer file.Close()
+
+	rows, rejected, err := importer.Parse(file, opts)
+	if err != nil {
+		exitWithError(err)
+	}
+	for _, row := range rejected {
+		fmt.Fprintf(os.Stderr, "line %d rejected: %s\n", row.Line, row.Reason)
+	}
+	if len(rows) == 0 {
+		exitWithError(fmt.Errorf("no website to crawl"))
+	}
+
+	initDbClient()
+
+	// the same limit as the crawl requests of the api
+	if appConfig.CrawlMaxBacklog > 0 {
+		backlog, err := dbClient.CrawlBacklog()
+		if err != nil {
+			exitWithError(err)
+		}
+		if backlog.Queued+len(rows) > appConfig.CrawlMaxBacklog {
+			exitWithError(fmt.Errorf("too many crawls are waiting: %d queued, %d to import and OPENBUZZ_CRAWL_MAX_BACKLOG is %d", backlog.Queued, len(rows), appConfig.CrawlMaxBacklog))
+		}
+	}
+
+	targets := []orm.CrawlTarget{}
+	for _, row := range rows {
+		targets = append(targets, row.Target)
+	}
+	job, err := dbClient.CreateCrawlJob(targets)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	fmt.Printf("%d websites queued in the job %s, %d lines rejected\n", len(rows), job.JobID, len(rejected))
+}
+
+// initDbClient connects to postgresql for the commands which don't start the server
+func initDbClient() {
+	if err := inject.Populate(appConfig, dbClient, logger, dispatcher); err != nil {
+		exitWithError(err)
+	}
+	if err := dbClient.Init(); err != nil {
+		exitWithError(err)
+	}
+}
+
+func exitWithError(err error) {
+	fmt.Fprintln(os.Stderr, err.Error())
+	os.Exit(1)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/arthurgustin/openbuzz/shared"
+	"github.com/rs/cors"
+)
+
+// exposedHeaders are the response headers the browsers let the scripts read
+var exposedHeaders = []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After"}
+
+// newCors builds the cors policy from the configuration. Without allowed origin, the browsers
+// refuse the cross-origin calls, the permissive policy must be asked explicitly.
+func newCors(config *shared.AppConfig) (*cors.Cors, error) {
+	if config.CorsAllowAll {
+		logger.Warn("cors allows all origins, any website can call the api from the browser of a user")
+		return cors.AllowAll(), nil
+	}
+
+	for _, origin := range config.CorsAllowedOrigins {
+		if origin == "*" && config.CorsAllowCredentials {
+			return nil, errors.New("cors credentials cannot be allowed for all origins, list the origins or use OPENBUZZ_CORS_ALLOW_ALL")
+		}
+	}
+
+	opts := cors.Options{
+		AllowedOrigins:   config.CorsAllowedOrigins,
+		AllowedMethods:   config.CorsAllowedMethods,
+		AllowedHeaders:   config.CorsAllowedHeaders,
+		ExposedHeaders:   exposedHeaders,
+		AllowCredentials: config.CorsAllowCredentials,
+		MaxAge:           config.CorsMaxAge,
+	}
+	if len(opts.AllowedOrigins) == 0 {
+		// cors allows all the origins when none is given
+		opts.AllowOriginFunc = func(origin string) bool {
+			return false
+		}
+	}
+	return cors.New(opts), nil
+}
@@ -3,6 +3,7 @@ package crawler
 import (
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/PuerkitoBio/fetchbot"
 	"github.com/arthurgustin/openbuzz/orm"
@@ -22,42 +23,184 @@ type Crawler struct {
 	Config      *shared.AppConfig      `inject:""`
 }
 
+// CrawlResponse is what has been extracted from a website during one crawl
 type CrawlResponse struct {
-	SocialNetworks struct {
-		Google   []string `json:"google"`
-		Youtube  []string `json:"youtube"`
-		Twitter  []string `json:"twitter"`
-		Facebook []string `json:"facebook"`
-	} `json:"socialNetworks"`
-	Email []string `json:"email"`
+	Url            string          `json:"url"`
+	FirstName      string          `json:"firstName"`
+	MiddleName     string          `json:"middleName"`
+	LastName       string          `json:"lastName"`
+	Description    string          `json:"description"`
+	SocialNetworks []SocialNetwork `json:"socialNetworks"`
+	Email          []FoundEmail    `json:"email"`
+	Tags           []string        `json:"tags"`
+	Icons          []string        `json:"icons"`
+	PagesVisited   []string        `json:"pagesVisited"`
+	// Changes are the differences with what was known before the crawl, see ReportID
+	ReportID string   `json:"reportId"`
+	Changes  []Change `json:"changes"`
+	// Partial is set when the website was not fetched, e.g it was down, the informations known
+	// before are then kept
+	Partial bool `json:"partial"`
+}
+
+// Change is an information added, removed or updated by the crawl
+type Change struct {
+	Type     string `json:"type"`
+	Field    string `json:"field"`
+	OldValue string `json:"oldValue,omitempty"`
+	NewValue string `json:"newValue,omitempty"`
+}
+
+type SocialNetwork struct {
+	Name       string  `json:"name"`
+	Link       string  `json:"link"`
+	Confidence float64 `json:"confidence"`
+}
+
+type FoundEmail struct {
+	Email      string  `json:"email"`
+	Confidence float64 `json:"confidence"`
+	Source     string  `json:"source"`
 }
 
 type CrawlInputInformations struct {
 	TargetUrl, FirstName, MiddleName, LastName string
+	Options                                    CrawlOptions
+	// JobID is the crawl job recorded in the history of the prospect, it can be empty
+	JobID string
+	// Listener is notified of the progress of the crawl, it can be nil
+	Listener EventListener
+}
+
+// CrawlOptions overrides the default behaviour of the crawler for one website, zero values keep the defaults
+type CrawlOptions struct {
+	// MaxDepth is the number of path segments a page can have to be crawled, e.g 1 for http://foo.bar/a
+	MaxDepth int
+	// TimeBudget is the time spent fetching pages
+	TimeBudget        time.Duration
+	SkipEmailGuessing bool
 }
 
+const defaultMaxDepth = 1
+
 func (c *Crawler) CrawlWebsite(input CrawlInputInformations) (CrawlResponse, error) {
 	if input.TargetUrl == "" {
 		return CrawlResponse{}, ErrTargetUrlEmpty
 	}
 
-	prospect := orm.NewProspect(input.TargetUrl).SetFirstName(input.FirstName).SetMiddleName(input.MiddleName).SetLastName(input.LastName)
+	// the prospect is saved with the canonical url, the website is crawled where it redirects to,
+	// SaveCrawl keeps the prospect of the target url when it redirects to another domain
+	siteUrl := finalUrl(input.TargetUrl)
+	prospect := orm.NewProspect(siteUrl).SetFirstName(input.FirstName).SetMiddleName(input.MiddleName).SetLastName(input.LastName)
 
 	responseHandler := &ResponseHandler{
-		prospect: prospect,
+		prospect:    prospect,
+		siteUrl:     siteUrl,
+		emailFinder: c.EmailFinder,
 		alreadyVisited: map[string]bool{
-			input.TargetUrl: true,
+			siteUrl: true,
 		},
 		socialStrategies: GetAllSocialStrategies(),
+		maxDepth:         defaultMaxDepth,
+		listener:         input.Listener,
 		Logger:           c.Logger,
 	}
+	if input.Options.MaxDepth > 0 {
+		responseHandler.maxDepth = input.Options.MaxDepth
+	}
 
 	mux := c.NewMux(responseHandler)
 
 	f := NewFetch(mux, c.Logger)
-	f.Fetch(input.TargetUrl)
+	if input.Options.TimeBudget > 0 {
+		f.stopAfter = input.Options.TimeBudget
+		f.cancelAfter = input.Options.TimeBudget
+	}
+	f.Fetch(siteUrl)
+
+	if !input.Options.SkipEmailGuessing {
+		c.guessEmails(prospect, input.Listener)
+	}
+
+	report, err := c.DbClient.WithActor(orm.Actor{Type: orm.ActorCrawl, ID: input.JobID}).SaveCrawl(prospect, input.TargetUrl, input.JobID, !responseHandler.fetched())
+	if err != nil {
+		return CrawlResponse{}, err
+	}
+
+	return c.newCrawlResponse(prospect, report, responseHandler.pagesVisited), nil
+}
+
+func (c *Crawler) newCrawlResponse(prospect *orm.Prospect, report orm.CrawlReport, pagesVisited []string) CrawlResponse {
+	resp := CrawlResponse{
+		ReportID:       report.ReportID,
+		Url:            prospect.GetUrl(),
+		FirstName:      prospect.GetFirstName(),
+		MiddleName:     prospect.GetMiddleName(),
+		LastName:       prospect.GetLastName(),
+		SocialNetworks: []SocialNetwork{},
+		Email:          []FoundEmail{},
+		Tags:           []string{},
+		Icons:          []string{},
+		PagesVisited:   pagesVisited,
+		Changes:        []Change{},
+		Partial:        report.Partial,
+	}
+	for _, change := range report.Changes {
+		resp.Changes = append(resp.Changes, Change{
+			Type:     change.Type,
+			Field:    change.Field,
+			OldValue: change.OldValue,
+			NewValue: change.NewValue,
+		})
+	}
+	if resp.PagesVisited == nil {
+		resp.PagesVisited = []string{}
+	}
+
+	// The same information can be found on several pages, keep the best one
+	best := map[string]orm.ProspectInfo{}
+	order := []string{}
+	for _, info := range prospect.GetInfos() {
+		key := info.Key + "\x00" + info.Val
+		previous, found := best[key]
+		if !found {
+			order = append(order, key)
+		}
+		if !found || info.Confidence > previous.Confidence {
+			best[key] = info
+		}
+	}
 
-	emails, err := c.EmailFinder.Find(*prospect)
+	for _, key := range order {
+		info := best[key]
+		switch info.Key {
+		case "email":
+			resp.Email = append(resp.Email, FoundEmail{
+				Email:      info.Val,
+				Confidence: info.Confidence,
+				Source:     info.Source,
+			})
+		case "tag":
+			resp.Tags = append(resp.Tags, info.Val)
+		case "icon":
+			resp.Icons = append(resp.Icons, info.Val)
+		case "description":
+			resp.Description = info.Val
+		case "domain":
+		default:
+			resp.SocialNetworks = append(resp.SocialNetworks, SocialNetwork{
+				Name:       info.Key,
+				Link:       info.Val,
+				Confidence: info.Confidence,
+			})
+		}
+	}
+
+	return resp
+}
+
+func (c *Crawler) guessEmails(prospect *orm.Prospect, listener EventListener) {
+	emails, err := c.EmailFinder.Find(*prospect, listener)
 	if err != nil {
 		switch err {
 		case ErrAllPolicyActivated:
@@ -65,14 +208,9 @@ func (c *Crawler) CrawlWebsite(input CrawlInputInformations) (CrawlResponse, err
 		}
 	}
 	for _, email := range emails {
-		prospect.SetEmail(email.email, 0.5)
+		listener.emit(EventEmailFound, prospect.GetUrl(), "email", email.email, "source", "smtp")
+		prospect.SetEmailWithSource(email.email, 0.5, orm.SourceSmtp)
 	}
-
-	if err = c.DbClient.Save(prospect); err != nil {
-		return CrawlResponse{}, err
-	}
-
-	return CrawlResponse{}, nil
 }
 
 func (c *Crawler) NewMux(responseHandler *ResponseHandler) *fetchbot.Mux {
@@ -90,7 +228,7 @@ func (c *Crawler) NewMux(responseHandler *ResponseHandler) *fetchbot.Mux {
 
 	// Handle HEAD requests for html responses coming from the source host - we don't want
 	// to crawl links from other hosts.
-	u, err := url.Parse(responseHandler.prospect.GetUrl())
+	u, err := url.Parse(responseHandler.siteUrl)
 	if err != nil {
 		panic(err)
 	}
@@ -1,24 +1,30 @@
 package crawler
 
 import (
+	"fmt"
 	"github.com/arthurgustin/openbuzz/orm"
 	"github.com/arthurgustin/openbuzz/shared"
 	"github.com/badoux/checkmail"
 	"github.com/bobesa/go-domain-util/domainutil"
 	"github.com/pkg/errors"
 	"strings"
+	"sync"
 )
 
 type EmailFinder struct {
 	Logger shared.LoggerInterface `inject:""`
 	Config *shared.AppConfig      `inject:""`
+	// smtpSlots is shared by all the crawls to limit the number of simultaneous smtp connections,
+	// mail servers blocklist us otherwise
+	smtpSlots chan bool
+	once      sync.Once
 }
 
 var (
 	ErrAllPolicyActivated = errors.New("All policy activated on this host")
 )
 
-func (f *EmailFinder) Find(prospect orm.Prospect) ([]Mail, error) {
+func (f *EmailFinder) Find(prospect orm.Prospect, listener EventListener) ([]Mail, error) {
 	allPolicyActivated, err := f.isAllPolicyActivated(prospect)
 	if err != nil {
 		f.Logger.Info(err.Error())
@@ -30,10 +36,11 @@ func (f *EmailFinder) Find(prospect orm.Prospect) ([]Mail, error) {
 
 	mails := []Mail{}
 	for _, mail := range f.generatePossibleMails(prospect) {
-		isReachable, err := mail.isReachable()
+		isReachable, err := f.isReachable(mail)
 		if err != nil {
 			f.Logger.Info("not reachable", "email", mail.email, "err", err.Error())
 		}
+		listener.emit(EventEmailVerified, prospect.GetUrl(), "email", mail.email, "reachable", fmt.Sprintf("%t", isReachable))
 		if isReachable {
 			mails = append(mails, mail)
 		}
@@ -46,9 +53,40 @@ func (f *EmailFinder) isAllPolicyActivated(prospect orm.Prospect) (bool, error)
 	m := Mail{
 		email: "all_policy_activated@" + domainutil.Domain(prospect.GetUrl()),
 	}
+	return f.isReachable(m)
+}
+
+func (f *EmailFinder) isReachable(m Mail) (bool, error) {
+	f.acquireSmtpSlot()
+	defer f.releaseSmtpSlot()
+
 	return m.isReachable()
 }
 
+// ValidateHost checks that the mail server of the email accepts it, it waits for an smtp slot like
+// the guessed emails do
+func (f *EmailFinder) ValidateHost(email string) error {
+	f.acquireSmtpSlot()
+	defer f.releaseSmtpSlot()
+
+	return checkmail.ValidateHost(email)
+}
+
+func (f *EmailFinder) acquireSmtpSlot() {
+	f.once.Do(func() {
+		slots := 1
+		if f.Config != nil && f.Config.SmtpWorkers > 0 {
+			slots = f.Config.SmtpWorkers
+		}
+		f.smtpSlots = make(chan bool, slots)
+	})
+	f.smtpSlots <- true
+}
+
+func (f *EmailFinder) releaseSmtpSlot() {
+	<-f.smtpSlots
+}
+
 func (f *EmailFinder) generatePossibleMails(prospect orm.Prospect) []Mail {
 	mails := []Mail{}
 
@@ -0,0 +1,89 @@
+package crawler
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	EventCrawlStarted     = "crawl.started"
+	EventCrawlFinished    = "crawl.finished"
+	EventCrawlFailed      = "crawl.failed"
+	EventPageFetched      = "page.fetched"
+	EventEmailFound       = "email.found"
+	EventEmailVerified    = "email.verified"
+	EventSocialFound      = "social.found"
+	EventNameFound        = "name.found"
+	EventIconFound        = "icon.found"
+	EventTagFound         = "tag.found"
+	EventDescriptionFound = "description.found"
+)
+
+type Event struct {
+	Type      string            `json:"type"`
+	TargetUrl string            `json:"targetUrl"`
+	Data      map[string]string `json:"data"`
+	Time      time.Time         `json:"time"`
+}
+
+// EventListener is called synchronously while crawling, it must not block
+type EventListener func(Event)
+
+func (l EventListener) emit(eventType, targetUrl string, fields ...string) {
+	if l == nil {
+		return
+	}
+	data := map[string]string{}
+	for i := 0; i < len(fields)-1; i += 2 {
+		data[fields[i]] = fields[i+1]
+	}
+	l(Event{
+		Type:      eventType,
+		TargetUrl: targetUrl,
+		Data:      data,
+		Time:      time.Now(),
+	})
+}
+
+// EventBus dispatches the crawl events to the subscribers of a crawl job
+type EventBus struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan Event]bool
+}
+
+// Publish never blocks, events are dropped for the subscribers which are too slow to consume them
+func (b *EventBus) Publish(jobId string, e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for subscriber := range b.subscribers[jobId] {
+		select {
+		case subscriber <- e:
+		default:
+		}
+	}
+}
+
+func (b *EventBus) Subscribe(jobId string) (events chan Event, unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subscribers == nil {
+		b.subscribers = map[string]map[chan Event]bool{}
+	}
+	if b.subscribers[jobId] == nil {
+		b.subscribers[jobId] = map[chan Event]bool{}
+	}
+	events = make(chan Event, 100)
+	b.subscribers[jobId][events] = true
+
+	return events, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		delete(b.subscribers[jobId], events)
+		if len(b.subscribers[jobId]) == 0 {
+			delete(b.subscribers, jobId)
+		}
+	}
+}
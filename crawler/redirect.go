@@ -0,0 +1,29 @@
+package crawler
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+var redirectClient = &http.Client{Timeout: 10 * time.Second}
+
+// finalUrl follows the redirects of a url, e.g from http://korben.info to https://www.korben.info/,
+// the url is returned as is when the website does not answer
+func finalUrl(targetUrl string) string {
+	if !strings.Contains(targetUrl, "://") {
+		targetUrl = "http://" + targetUrl
+	}
+
+	res, err := redirectClient.Head(targetUrl)
+	if err == nil && res.StatusCode == http.StatusMethodNotAllowed {
+		// some servers only answer to GET
+		res.Body.Close()
+		res, err = redirectClient.Get(targetUrl)
+	}
+	if err != nil {
+		return targetUrl
+	}
+	res.Body.Close()
+	return res.Request.URL.String()
+}
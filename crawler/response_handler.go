@@ -1,6 +1,7 @@
 package crawler
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
 	"sync"
@@ -16,11 +17,20 @@ import (
 )
 
 type ResponseHandler struct {
-	prospect         *orm.Prospect
-	fetchbotHandler  fetchbot.HandlerFunc
-	mu               sync.Mutex
-	alreadyVisited   map[string]bool
+	prospect *orm.Prospect
+	// siteUrl is the url the crawl started from, the pages of other hosts are not crawled
+	siteUrl string
+	// emailFinder limits the smtp connections of all the crawls
+	emailFinder     *EmailFinder
+	fetchbotHandler fetchbot.HandlerFunc
+	mu              sync.Mutex
+	alreadyVisited  map[string]bool
+	pagesVisited    []string
+	// rootStatus is the status of the page the crawl started from, 0 until it is fetched
+	rootStatus       int
 	socialStrategies []SocialStrategy
+	maxDepth         int
+	listener         EventListener
 	Logger           shared.LoggerInterface `inject:""`
 	Config           *shared.AppConfig      `inject:""`
 }
@@ -41,11 +51,26 @@ func (h *ResponseHandler) getHandler() fetchbot.HandlerFunc {
 			h.Logger.Warn(err.Error(), "method", ctx.Cmd.Method(), "url", ctx.Cmd.URL().String())
 			return
 		}
+		h.listener.emit(EventPageFetched, h.prospect.GetUrl(), "page", ctx.Cmd.URL().String(), "code", fmt.Sprintf("%d", res.StatusCode))
+		h.mu.Lock()
+		h.pagesVisited = append(h.pagesVisited, ctx.Cmd.URL().String())
+		if ctx.Cmd.URL().String() == h.siteUrl {
+			h.rootStatus = res.StatusCode
+		}
+		h.mu.Unlock()
 		// Enqueue all links as GET requests
 		h.enqueueLinks(ctx, doc)
 	}
 }
 
+// fetched is true when the website answered, the informations a crawl does not find again are
+// removed only then
+func (h *ResponseHandler) fetched() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.pagesVisited) > 0 && h.rootStatus >= 200 && h.rootStatus <= 299
+}
+
 func (h *ResponseHandler) enqueueLinks(ctx *fetchbot.Context, doc *goquery.Document) {
 	h.parseHead(ctx, doc)
 	h.parseBody(ctx, doc)
@@ -78,6 +103,7 @@ func (h *ResponseHandler) findNames(ctx *fetchbot.Context, s *goquery.Selection)
 				firstName := strings.Split(name, " ")[0]
 				lastName := strings.Split(name, " ")[1]
 				h.Logger.Info("found name", "firstName", firstName, "lastName", lastName)
+				h.listener.emit(EventNameFound, h.prospect.GetUrl(), "firstName", firstName, "lastName", lastName)
 				h.prospect.SetFirstName(firstName)
 				h.prospect.SetLastName(lastName)
 			}
@@ -102,12 +128,13 @@ func (h *ResponseHandler) parseHrefBody(ctx *fetchbot.Context, s *goquery.Select
 		if strings.HasPrefix(val, "mailto:") {
 			mail := strings.Split(val, "mailto:")[1]
 			if err := checkmail.ValidateFormat(mail); err == nil {
-				err := checkmail.ValidateHost(mail)
+				err := h.emailFinder.ValidateHost(mail)
 				if smtpErr, ok := err.(checkmail.SmtpError); ok && err != nil {
 					h.Logger.Warn(smtpErr.Error(), "code", smtpErr.Code())
 				} else {
 					h.Logger.Info("Found valid mailto", "mail", mail)
-					h.prospect.SetEmail(mail, 1)
+					h.listener.emit(EventEmailFound, h.prospect.GetUrl(), "email", mail, "source", "mailto")
+					h.prospect.SetEmailWithSource(mail, 1, orm.SourceMailto)
 				}
 			}
 			return
@@ -122,12 +149,12 @@ func (h *ResponseHandler) parseHrefBody(ctx *fetchbot.Context, s *goquery.Select
 		h.findSocialMediaInformations(url)
 
 		// We only want to get first level pages, others are less relevant
-		if h.getUrlLevelNumber(url) > 1 {
+		if h.getUrlLevelNumber(url) > h.maxDepth {
 			return
 		}
 
 		// Don't care about other domains
-		if !strings.Contains(h.prospect.GetUrl(), u.Host) {
+		if !strings.Contains(h.siteUrl, u.Host) {
 			return
 		}
 
@@ -163,6 +190,7 @@ func (h *ResponseHandler) parseHead(ctx *fetchbot.Context, doc *goquery.Document
 
 			if h.isLinkAnImage(link) {
 				h.Logger.Info("FOUND ICON: " + link)
+				h.listener.emit(EventIconFound, h.prospect.GetUrl(), "icon", link)
 				h.prospect.SetIcon(link)
 			}
 		})
@@ -174,6 +202,7 @@ func (h *ResponseHandler) parseHead(ctx *fetchbot.Context, doc *goquery.Document
 			for _, tag := range tags {
 				tag = strings.Trim(tag, " ")
 				h.Logger.Info("FOUND TAG: " + tag)
+				h.listener.emit(EventTagFound, h.prospect.GetUrl(), "tag", tag)
 				h.prospect.SetTag(tag)
 			}
 		})
@@ -181,6 +210,7 @@ func (h *ResponseHandler) parseHead(ctx *fetchbot.Context, doc *goquery.Document
 			content, _ := s.Attr("content")
 			content = h.decodeURIComponent(content)
 			h.Logger.Info("FOUND DESCRIPTION: " + content)
+			h.listener.emit(EventDescriptionFound, h.prospect.GetUrl(), "description", content)
 
 			h.prospect.SetDescription(content)
 		})
@@ -228,6 +258,7 @@ func (h *ResponseHandler) findSocialMediaInformations(targetUrl string) {
 			confidence = h.normalizedLevenstein(s[1], h.prospect.GetDomainNameWithoutExtension())
 		}
 		//if confidence > 0 {
+		h.listener.emit(EventSocialFound, h.prospect.GetUrl(), "name", socialStrategy.GetName(), "link", targetUrl, "confidence", fmt.Sprintf("%.2f", confidence))
 		h.prospect.SetSocial(socialStrategy.GetName(), targetUrl, confidence)
 		//}
 	}
@@ -0,0 +1,144 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/arthurgustin/openbuzz/orm"
+	"github.com/arthurgustin/openbuzz/shared"
+	"github.com/arthurgustin/openbuzz/webhook"
+	"github.com/golang-plus/uuid"
+)
+
+// Worker consumes the crawl queue stored in postgresql with a fixed number of goroutines. Urls are
+// leased while being crawled so that the ones left behind by a crashed or restarted process are
+// picked up again.
+type Worker struct {
+	DbClient *orm.Client            `inject:""`
+	Crawler  *Crawler               `inject:""`
+	Logger   shared.LoggerInterface `inject:""`
+	Config   *shared.AppConfig      `inject:""`
+	EventBus *EventBus              `inject:""`
+	Webhooks interface {
+		Notify(event string, data interface{})
+	} `inject:""`
+	id string
+}
+
+func (w *Worker) Start() error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	w.id = fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), id.String())
+
+	w.Logger.Info("starting crawl workers", "worker", w.id, "count", fmt.Sprintf("%d", w.Config.CrawlWorkers))
+	for i := 0; i < w.Config.CrawlWorkers; i++ {
+		go w.run()
+	}
+	return nil
+}
+
+func (w *Worker) run() {
+	for {
+		item, claimed, err := w.DbClient.ClaimCrawlJobItem(w.id, w.Config.CrawlLeaseDuration, w.Config.CrawlMaxAttempts)
+		if err != nil {
+			w.Logger.Warn("unable to claim a crawl", "err", err.Error())
+		}
+		if !claimed {
+			time.Sleep(w.Config.CrawlPollInterval)
+			continue
+		}
+
+		w.crawl(item)
+	}
+}
+
+func (w *Worker) crawl(item orm.CrawlJobItem) {
+	start := time.Now()
+	stopHeartbeat := make(chan bool)
+	defer close(stopHeartbeat)
+	go w.heartbeat(item, stopHeartbeat)
+
+	listener := EventListener(func(e Event) {
+		w.EventBus.Publish(item.JobID, e)
+	})
+
+	w.Logger.Info(fmt.Sprintf("crawling %s", item.Url), "jobId", item.JobID, "attempt", fmt.Sprintf("%d", item.Attempts))
+	listener.emit(EventCrawlStarted, item.Url, "attempt", fmt.Sprintf("%d", item.Attempts))
+	resp, err := w.Crawler.CrawlWebsite(CrawlInputInformations{
+		TargetUrl:  item.Url,
+		FirstName:  item.FirstName,
+		MiddleName: item.MiddleName,
+		LastName:   item.LastName,
+		Options: CrawlOptions{
+			MaxDepth:          item.MaxDepth,
+			TimeBudget:        item.TimeBudget,
+			SkipEmailGuessing: item.SkipEmailGuessing,
+		},
+		JobID:    item.JobID,
+		Listener: listener,
+	})
+
+	switch {
+	case err == nil:
+		err = w.DbClient.CompleteCrawlJobItem(item.ItemID, w.id, w.encodeResponse(resp))
+		listener.emit(EventCrawlFinished, item.Url)
+		w.Webhooks.Notify(webhook.EventCrawlFinished, webhook.CrawlData{
+			JobID:  item.JobID,
+			Url:    item.Url,
+			Result: resp,
+		})
+	case item.Attempts < w.Config.CrawlMaxAttempts && err != ErrTargetUrlEmpty:
+		w.Logger.Warn(err.Error(), "jobId", item.JobID, "url", item.Url)
+		reason := err.Error()
+		err = w.DbClient.RetryCrawlJobItem(item.ItemID, w.id, reason)
+		listener.emit(EventCrawlFailed, item.Url, "reason", reason, "retry", "true")
+	default:
+		w.Logger.Warn(err.Error(), "jobId", item.JobID, "url", item.Url)
+		reason := err.Error()
+		err = w.DbClient.FailCrawlJobItem(item.ItemID, w.id, reason)
+		listener.emit(EventCrawlFailed, item.Url, "reason", reason, "retry", "false")
+		w.Webhooks.Notify(webhook.EventCrawlFailed, webhook.CrawlData{
+			JobID:  item.JobID,
+			Url:    item.Url,
+			Reason: reason,
+		})
+	}
+	if err != nil {
+		w.Logger.Warn("unable to update the crawl status", "jobId", item.JobID, "url", item.Url, "err", err.Error())
+	}
+
+	w.Logger.Info(fmt.Sprintf("%s has been crawled", item.Url), "jobId", item.JobID, "elapsed", time.Now().Sub(start).String())
+}
+
+func (w *Worker) encodeResponse(resp CrawlResponse) string {
+	result, err := json.Marshal(resp)
+	if err != nil {
+		w.Logger.Warn("unable to encode the crawl result", "url", resp.Url, "err", err.Error())
+		return ""
+	}
+	return string(result)
+}
+
+func (w *Worker) heartbeat(item orm.CrawlJobItem, stop chan bool) {
+	ticker := time.NewTicker(w.Config.CrawlLeaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := w.DbClient.HeartbeatCrawlJobItem(item.ItemID, w.id, w.Config.CrawlLeaseDuration); err != nil {
+				w.Logger.Warn("unable to extend the crawl lease", "jobId", item.JobID, "url", item.Url, "err", err.Error())
+			}
+		}
+	}
+}
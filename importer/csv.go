@@ -0,0 +1,292 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/arthurgustin/openbuzz/orm"
+)
+
+var (
+	ErrEmptyFile        = errors.New("the file is empty")
+	ErrNoUrlColumn      = errors.New("unable to find the website column, please provide it")
+	ErrUnknownColumn    = errors.New("unknown column")
+	ErrUnknownDelimiter = errors.New("delimiter must be comma, semicolon or tab")
+)
+
+// ColumnMapping tells where the informations are in the file, a column is either the name of a
+// header (case insensitive) or a 1-based index. Empty columns are detected from the header.
+type ColumnMapping struct {
+	Url        string
+	FirstName  string
+	MiddleName string
+	LastName   string
+}
+
+type Options struct {
+	Mapping ColumnMapping
+	// Delimiter is detected from the first line when it is 0
+	Delimiter rune
+	// HasHeader is detected from the first line when it is nil
+	HasHeader *bool
+}
+
+// Row is a valid line of the file, Line is 1-based
+type Row struct {
+	Line   int
+	Target orm.CrawlTarget
+}
+
+type RejectedRow struct {
+	Line   int
+	Reason string
+}
+
+var columnAliases = map[string][]string{
+	"url":        {"url", "website", "web site", "site", "site web", "domain", "domaine", "homepage"},
+	"firstName":  {"firstname", "first name", "first_name", "given name", "prenom", "prénom"},
+	"middleName": {"middlename", "middle name", "middle_name"},
+	"lastName":   {"lastname", "last name", "last_name", "surname", "family name", "nom"},
+}
+
+// Parse reads a csv file of crawl targets. Invalid lines are rejected with the reason, err is only
+// set when the file cannot be read at all.
+func Parse(r io.Reader, opts Options) (rows []Row, rejected []RejectedRow, err error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	text := strings.TrimPrefix(string(content), "\xEF\xBB\xBF")
+	if strings.TrimSpace(text) == "" {
+		return nil, nil, ErrEmptyFile
+	}
+
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comma = opts.Delimiter
+	if reader.Comma == 0 {
+		reader.Comma = detectDelimiter(text)
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var indexes map[string]int
+	read := false
+	for {
+		record, readErr := reader.Read()
+		if readErr == io.EOF {
+			break
+		}
+		// a malformed line only rejects itself, the reader goes on with the next one
+		if parseErr, ok := readErr.(*csv.ParseError); ok {
+			rejected = append(rejected, RejectedRow{
+				Line:   parseErr.StartLine,
+				Reason: parseErr.Err.Error(),
+			})
+			continue
+		}
+		if readErr != nil {
+			return nil, nil, readErr
+		}
+		// the line where the record starts, a quoted cell can span several lines
+		line, _ := reader.FieldPos(0)
+
+		if !read {
+			read = true
+			hasHeader := isHeader(record)
+			if opts.HasHeader != nil {
+				hasHeader = *opts.HasHeader
+			}
+			var header []string
+			if hasHeader {
+				header = record
+			}
+			if indexes, err = resolveMapping(opts.Mapping, header); err != nil {
+				return nil, nil, err
+			}
+			if hasHeader {
+				continue
+			}
+		}
+		if isBlank(record) {
+			continue
+		}
+
+		target := orm.CrawlTarget{
+			Url:        cell(record, indexes["url"]),
+			FirstName:  cell(record, indexes["firstName"]),
+			MiddleName: cell(record, indexes["middleName"]),
+			LastName:   cell(record, indexes["lastName"]),
+		}
+		if target.Url, err = normalizeUrl(target.Url); err != nil {
+			rejected = append(rejected, RejectedRow{
+				Line:   line,
+				Reason: err.Error(),
+			})
+			continue
+		}
+		rows = append(rows, Row{
+			Line:   line,
+			Target: target,
+		})
+	}
+	if !read && len(rejected) == 0 {
+		return nil, nil, ErrEmptyFile
+	}
+
+	return rows, rejected, nil
+}
+
+// ParseDelimiter reads a delimiter given by a user, an empty name means that it is detected
+func ParseDelimiter(name string) (rune, error) {
+	switch name {
+	case "", "auto":
+		return 0, nil
+	case "comma", ",":
+		return ',', nil
+	case "semicolon", ";":
+		return ';', nil
+	case "tab", "\t":
+		return '\t', nil
+	}
+	return 0, ErrUnknownDelimiter
+}
+
+func detectDelimiter(text string) rune {
+	firstLine := strings.SplitN(text, "\n", 2)[0]
+	best, bestCount := ',', 0
+	for _, delimiter := range []rune{',', ';', '\t'} {
+		if count := strings.Count(firstLine, string(delimiter)); count > bestCount {
+			best, bestCount = delimiter, count
+		}
+	}
+	return best
+}
+
+// isHeader considers that the first line is a header when no cell is a url and at least one cell
+// is a known column name
+func isHeader(record []string) bool {
+	known := false
+	for _, c := range record {
+		if _, err := normalizeUrl(c); err == nil {
+			return false
+		}
+		if aliasOf(c) != "" {
+			known = true
+		}
+	}
+	return known
+}
+
+func aliasOf(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for field, aliases := range columnAliases {
+		for _, alias := range aliases {
+			if name == alias {
+				return field
+			}
+		}
+	}
+	return ""
+}
+
+// resolveMapping returns the 0-based index of each field, -1 when the field is absent
+func resolveMapping(mapping ColumnMapping, header []string) (map[string]int, error) {
+	requested := map[string]string{
+		"url":        mapping.Url,
+		"firstName":  mapping.FirstName,
+		"middleName": mapping.MiddleName,
+		"lastName":   mapping.LastName,
+	}
+	// Files without header nor mapping are expected to be: website, first name, last name
+	defaults := map[string]int{
+		"url":        0,
+		"firstName":  1,
+		"middleName": -1,
+		"lastName":   2,
+	}
+
+	indexes := map[string]int{}
+	for field, column := range requested {
+		indexes[field] = -1
+		switch {
+		case column != "":
+			index, err := columnIndex(column, header)
+			if err != nil {
+				return nil, err
+			}
+			indexes[field] = index
+		case header != nil:
+			for i, name := range header {
+				if aliasOf(name) == field {
+					indexes[field] = i
+					break
+				}
+			}
+		default:
+			indexes[field] = defaults[field]
+		}
+	}
+
+	if indexes["url"] < 0 {
+		return nil, ErrNoUrlColumn
+	}
+	return indexes, nil
+}
+
+func columnIndex(column string, header []string) (int, error) {
+	if index, err := strconv.Atoi(column); err == nil && index > 0 {
+		return index - 1, nil
+	}
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), strings.TrimSpace(column)) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("%s: %s", ErrUnknownColumn.Error(), column)
+}
+
+func cell(record []string, index int) string {
+	if index < 0 || index >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[index])
+}
+
+func isBlank(record []string) bool {
+	for _, c := range record {
+		if strings.TrimSpace(c) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeUrl accepts bare domains, e.g korben.info, which are common in lead lists
+func normalizeUrl(rawUrl string) (string, error) {
+	rawUrl = strings.TrimSpace(rawUrl)
+	if rawUrl == "" {
+		return "", errors.New("the website is empty")
+	}
+	withScheme := rawUrl
+	if !strings.Contains(rawUrl, "://") {
+		withScheme = "http://" + rawUrl
+	}
+
+	u, err := url.Parse(withScheme)
+	if err != nil {
+		return "", fmt.Errorf("%s is not a valid url", rawUrl)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("%s is not an http or https url", rawUrl)
+	}
+	if u.Host == "" || !strings.Contains(u.Hostname(), ".") || strings.ContainsAny(u.Host, " @") {
+		return "", fmt.Errorf("%s is not a valid website", rawUrl)
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,107 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func urls(rows []Row) (found []string) {
+	for _, row := range rows {
+		found = append(found, row.Target.Url)
+	}
+	return
+}
+
+func lines(rows []Row) (found []int) {
+	for _, row := range rows {
+		found = append(found, row.Line)
+	}
+	return
+}
+
+func TestParseWithHeader(t *testing.T) {
+	rows, rejected, err := Parse(strings.NewReader("Website,First name,Last name\nkorben.info,Korben,Dallas\nhttps://example.com,,\n"), Options{})
+	require.NoError(t, err)
+	assert.Empty(t, rejected)
+	assert.Equal(t, []string{"http://korben.info", "https://example.com"}, urls(rows))
+	assert.Equal(t, []int{2, 3}, lines(rows))
+	assert.Equal(t, "Korben", rows[0].Target.FirstName)
+	assert.Equal(t, "Dallas", rows[0].Target.LastName)
+}
+
+func TestParseWithoutHeader(t *testing.T) {
+	rows, rejected, err := Parse(strings.NewReader("korben.info;Korben;Dallas\nexample.com;Alice;Doe\n"), Options{})
+	require.NoError(t, err)
+	assert.Empty(t, rejected)
+	assert.Equal(t, []int{1, 2}, lines(rows))
+	assert.Equal(t, "Alice", rows[1].Target.FirstName)
+	assert.Equal(t, "Doe", rows[1].Target.LastName)
+}
+
+func TestParseSkipsTheByteOrderMark(t *testing.T) {
+	rows, _, err := Parse(strings.NewReader("\xEF\xBB\xBFurl\tnom\nkorben.info\tDallas\n"), Options{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://korben.info"}, urls(rows))
+	assert.Equal(t, "Dallas", rows[0].Target.LastName)
+}
+
+func TestParseReportsTheLineWhereAMultiLineRecordStarts(t *testing.T) {
+	text := "url,first name\n\"korben.info\",\"Korben\nthe second line\"\nexample.com,Alice\n"
+	rows, rejected, err := Parse(strings.NewReader(text), Options{})
+	require.NoError(t, err)
+	assert.Empty(t, rejected)
+	assert.Equal(t, []int{2, 4}, lines(rows))
+	assert.Equal(t, "Korben\nthe second line", rows[0].Target.FirstName)
+}
+
+func TestParseRejectsTheInvalidLinesOneByOne(t *testing.T) {
+	text := "url,first name\nkorben.info,Korben\nnot a website,Bob\nexa\"mple.com,Eve\n\nftp://example.com,Carol\nexample.com,Alice\n"
+	rows, rejected, err := Parse(strings.NewReader(text), Options{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://korben.info", "http://example.com"}, urls(rows))
+	assert.Equal(t, []int{2, 7}, lines(rows))
+
+	rejectedLines := []int{}
+	for _, r := range rejected {
+		rejectedLines = append(rejectedLines, r.Line)
+		assert.NotEmpty(t, r.Reason)
+	}
+	assert.Equal(t, []int{3, 4, 6}, rejectedLines)
+}
+
+func TestParseWithMapping(t *testing.T) {
+	hasHeader := false
+	rows, _, err := Parse(strings.NewReader("Dallas,korben.info\n"), Options{
+		Mapping:   ColumnMapping{Url: "2", LastName: "1"},
+		HasHeader: &hasHeader,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://korben.info"}, urls(rows))
+	assert.Equal(t, "Dallas", rows[0].Target.LastName)
+
+	_, _, err = Parse(strings.NewReader("nom,company\nDallas,Korben\n"), Options{})
+	assert.Equal(t, ErrNoUrlColumn, err)
+
+	_, _, err = Parse(strings.NewReader("url\nkorben.info\n"), Options{Mapping: ColumnMapping{FirstName: "prenom"}})
+	assert.EqualError(t, err, "unknown column: prenom")
+}
+
+func TestParseEmptyFile(t *testing.T) {
+	for _, text := range []string{"", "\xEF\xBB\xBF", " \n\n"} {
+		_, _, err := Parse(strings.NewReader(text), Options{})
+		assert.Equal(t, ErrEmptyFile, err, text)
+	}
+}
+
+func TestParseDelimiter(t *testing.T) {
+	for name, expected := range map[string]rune{"": 0, "auto": 0, "comma": ',', ";": ';', "tab": '\t'} {
+		delimiter, err := ParseDelimiter(name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, expected, delimiter, name)
+	}
+	_, err := ParseDelimiter("pipe")
+	assert.Equal(t, ErrUnknownDelimiter, err)
+}
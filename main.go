@@ -6,18 +6,21 @@ import (
 	"github.com/arthurgustin/openbuzz/api"
 	"github.com/arthurgustin/openbuzz/crawler"
 	"github.com/arthurgustin/openbuzz/orm"
+	"github.com/arthurgustin/openbuzz/scheduler"
 	"github.com/arthurgustin/openbuzz/shared"
+	"github.com/arthurgustin/openbuzz/webhook"
 	"github.com/facebookgo/inject"
 	"github.com/gorilla/mux"
 	"github.com/kelseyhightower/envconfig"
-	"github.com/rs/cors"
 	"net/http"
+	"os"
 )
 
 var (
-	logger    shared.LoggerInterface
-	appConfig = &shared.AppConfig{}
-	dbClient  = &orm.Client{}
+	logger     shared.LoggerInterface
+	appConfig  = &shared.AppConfig{}
+	dbClient   = &orm.Client{}
+	dispatcher = &webhook.Dispatcher{}
 )
 
 const configPrefix = "OPENBUZZ"
@@ -29,6 +32,19 @@ func main() {
 		logger.Fatal(err.Error())
 	}
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import":
+			importCommand(os.Args[2:])
+		case "apikey":
+			apikeyCommand(os.Args[2:])
+		default:
+			fmt.Fprintln(os.Stderr, "usage: openbuzz [import|apikey]")
+			os.Exit(2)
+		}
+		return
+	}
+
 	_, err := singleinstance.CreateLockFile("buzz.lock")
 	if err != nil {
 		logger.Fatal("an instance already exists")
@@ -38,7 +54,14 @@ func main() {
 	crawlerHandler := &api.CrawlerHandler{}
 	webCrawler := &crawler.Crawler{}
 	prospectorHandler := &api.ProspectHandler{}
-	if err := inject.Populate(appConfig, crawlerHandler, webCrawler, dbClient, logger, prospectorHandler); err != nil {
+	crawlWorker := &crawler.Worker{}
+	eventBus := &crawler.EventBus{}
+	webhookHandler := &api.WebhookHandler{}
+	authenticator := &api.Authenticator{}
+	trashPurger := &scheduler.TrashPurger{}
+	recrawler := &scheduler.Recrawler{}
+	if err := inject.Populate(appConfig, crawlerHandler, webCrawler, dbClient, logger, prospectorHandler, crawlWorker, eventBus,
+		dispatcher, webhookHandler, authenticator, trashPurger, recrawler); err != nil {
 		logger.Fatal(err.Error())
 		return
 	}
@@ -48,11 +71,41 @@ func main() {
 		return
 	}
 
+	if err := crawlWorker.Start(); err != nil {
+		logger.Fatal(err.Error())
+		return
+	}
+	dispatcher.Start()
+	trashPurger.Start()
+	recrawler.Start()
+
+	if appConfig.AuthDisabled {
+		logger.Warn("the authentication is disabled, anyone reaching the port can use the api")
+	}
+
 	r := mux.NewRouter()
-	r.HandleFunc("/api/v1/crawl", crawlerHandler.CrawlWebsite).Methods(http.MethodPost)
-	r.HandleFunc("/api/v1/list", prospectorHandler.List).Methods(http.MethodGet)
-	r.HandleFunc("/api/v1/prospect/{prospectId}", prospectorHandler.Delete).Methods(http.MethodDelete)
-	handler := cors.AllowAll().Handler(r)
+	r.Use(authenticator.Middleware)
+	openApi := &api.OpenApi{}
+	openApi.Routes = api.Routes(api.Handlers{
+		Crawler:  crawlerHandler,
+		Prospect: prospectorHandler,
+		Webhook:  webhookHandler,
+		OpenApi:  openApi,
+	})
+	for _, route := range openApi.Routes {
+		r.HandleFunc(route.Path, authenticator.Require(route.Scope, route.Handler)).Methods(route.Method)
+	}
+	if err := openApi.Check(r); err != nil {
+		logger.Fatal(err.Error())
+		return
+	}
+
+	corsPolicy, err := newCors(appConfig)
+	if err != nil {
+		logger.Fatal(err.Error())
+		return
+	}
+	handler := corsPolicy.Handler(r)
 
 	logger.Info("starting listening...", "port", fmt.Sprintf("%d", appConfig.Port))
 
@@ -0,0 +1,261 @@
+package orm
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-plus/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	ScopeRead   = "read"
+	ScopeWrite  = "write"
+	ScopeCrawl  = "crawl"
+	ScopeDelete = "delete"
+	// ScopeAdmin grants all the other scopes and the management of the webhooks
+	ScopeAdmin = "admin"
+
+	apiKeyPrefix = "ob_"
+)
+
+var AllScopes = []string{ScopeRead, ScopeWrite, ScopeCrawl, ScopeDelete, ScopeAdmin}
+
+var (
+	ErrApiKeyNotFound = errors.New("api key not found")
+	ErrUnknownScope   = errors.New("unknown scope, expected one of " + strings.Join(AllScopes, ", "))
+)
+
+type dbApiKey struct {
+	gorm.Model
+	KeyID string `gorm:"not null;unique"`
+	Name  string
+	// Prefix is the beginning of the key, it helps users to recognize their keys
+	Prefix string `gorm:"not null"`
+	// Hash is the sha256 of the key, the key itself is only shown when it is created
+	Hash   string `gorm:"not null;unique"`
+	Scopes string `gorm:"not null"`
+	// DailyCrawlQuota is the number of urls the key can queue per day (UTC), 0 means no limit
+	DailyCrawlQuota int
+}
+
+// dbApiKeyUsage counts the urls queued by a key on a day
+type dbApiKeyUsage struct {
+	ID        uint   `gorm:"primary_key"`
+	KeyID     string `gorm:"not null;unique_index:idx_api_key_usage_day"`
+	Day       string `gorm:"not null;unique_index:idx_api_key_usage_day"`
+	Crawls    int    `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+type ApiKey struct {
+	KeyID           string
+	Name            string
+	Prefix          string
+	Scopes          []string
+	DailyCrawlQuota int
+	CreatedAt       time.Time
+}
+
+// CrawlQuota is the usage of the daily crawl quota of a key
+type CrawlQuota struct {
+	// Limit is 0 when the key has no quota
+	Limit int
+	Used  int
+	Reset time.Time
+}
+
+func (q CrawlQuota) Remaining() int {
+	if q.Used >= q.Limit {
+		return 0
+	}
+	return q.Limit - q.Used
+}
+
+func (k ApiKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+func IsScope(name string) bool {
+	for _, scope := range AllScopes {
+		if scope == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateApiKey generates a new key, the returned secret is not stored and cannot be retrieved later
+func (c *Client) CreateApiKey(name string, scopes []string, dailyCrawlQuota int) (key ApiKey, secret string, err error) {
+	for _, scope := range scopes {
+		if !IsScope(scope) {
+			return key, "", ErrUnknownScope
+		}
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return
+	}
+	random := make([]byte, 32)
+	if _, err = rand.Read(random); err != nil {
+		return
+	}
+	secret = apiKeyPrefix + hex.EncodeToString(random)
+
+	dbKey := dbApiKey{
+		KeyID:           id.String(),
+		Name:            name,
+		Prefix:          secret[:len(apiKeyPrefix)+8],
+		Hash:            hashApiKey(secret),
+		Scopes:          strings.Join(scopes, ","),
+		DailyCrawlQuota: dailyCrawlQuota,
+	}
+	if err = c.Db.Create(&dbKey).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+	return toApiKey(dbKey), secret, nil
+}
+
+// FindApiKey returns the key matching a secret sent by a client
+func (c *Client) FindApiKey(secret string) (key ApiKey, err error) {
+	dbKey := dbApiKey{}
+	if err = c.Db.Model(&dbApiKey{}).Where("hash = ?", hashApiKey(secret)).First(&dbKey).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return key, ErrApiKeyNotFound
+		}
+		c.Logger.Warn(err.Error())
+		return
+	}
+	return toApiKey(dbKey), nil
+}
+
+func (c *Client) ListApiKeys() (keys []ApiKey, err error) {
+	dbKeys := []dbApiKey{}
+	if err = c.Db.Model(&dbApiKey{}).Order("id").Find(&dbKeys).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+	for _, dbKey := range dbKeys {
+		keys = append(keys, toApiKey(dbKey))
+	}
+	return
+}
+
+func (c *Client) RevokeApiKey(keyId string) error {
+	res := c.Db.Delete(&dbApiKey{}, "key_id = ?", keyId)
+	if res.Error != nil {
+		c.Logger.Warn(res.Error.Error())
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrApiKeyNotFound
+	}
+	return nil
+}
+
+// GetCrawlQuota returns how many urls the key has queued today
+func (c *Client) GetCrawlQuota(key ApiKey) (quota CrawlQuota, err error) {
+	day, reset := quotaDay(time.Now())
+	quota = CrawlQuota{Limit: key.DailyCrawlQuota, Reset: reset}
+
+	usage := dbApiKeyUsage{}
+	if err = c.Db.Model(&dbApiKeyUsage{}).Where("key_id = ? AND day = ?", key.KeyID, day).First(&usage).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return quota, nil
+		}
+		c.Logger.Warn(err.Error())
+		return
+	}
+	quota.Used = usage.Crawls
+	return
+}
+
+// ConsumeCrawlQuota counts n more urls queued by the key today. Nothing is counted and allowed is
+// false when it would exceed the quota.
+func (c *Client) ConsumeCrawlQuota(key ApiKey, n int) (quota CrawlQuota, allowed bool, err error) {
+	if key.DailyCrawlQuota <= 0 {
+		return CrawlQuota{}, true, nil
+	}
+	if n > key.DailyCrawlQuota {
+		quota, err = c.GetCrawlQuota(key)
+		return quota, false, err
+	}
+	day, reset := quotaDay(time.Now())
+	table := c.Db.NewScope(&dbApiKeyUsage{}).TableName()
+
+	// the conditional upsert is atomic, concurrent requests cannot exceed the quota together
+	rows, err := c.Db.Raw(fmt.Sprintf(`INSERT INTO %[1]s (key_id, day, crawls, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (key_id, day) DO UPDATE SET crawls = %[1]s.crawls + EXCLUDED.crawls, updated_at = EXCLUDED.updated_at
+		WHERE %[1]s.crawls + EXCLUDED.crawls <= ?
+		RETURNING crawls`, table),
+		key.KeyID, day, n, time.Now(), key.DailyCrawlQuota).Rows()
+	if err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		quota = CrawlQuota{Limit: key.DailyCrawlQuota, Reset: reset}
+		if err = rows.Scan(&quota.Used); err != nil {
+			return
+		}
+		return quota, true, nil
+	}
+	rows.Close()
+
+	quota, err = c.GetCrawlQuota(key)
+	return quota, false, err
+}
+
+// RefundCrawlQuota gives back n urls counted today by ConsumeCrawlQuota, e.g when they could not be queued
+func (c *Client) RefundCrawlQuota(key ApiKey, n int) error {
+	if key.DailyCrawlQuota <= 0 {
+		return nil
+	}
+	day, _ := quotaDay(time.Now())
+	if err := c.Db.Model(&dbApiKeyUsage{}).
+		Where("key_id = ? AND day = ?", key.KeyID, day).
+		UpdateColumns(map[string]interface{}{
+			"crawls":     gorm.Expr("GREATEST(crawls - ?, 0)", n),
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return err
+	}
+	return nil
+}
+
+// quotaDay returns the current day of the quotas and when it ends, days are in UTC
+func quotaDay(now time.Time) (day string, reset time.Time) {
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return start.Format("2006-01-02"), start.AddDate(0, 0, 1)
+}
+
+func hashApiKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func toApiKey(dbKey dbApiKey) ApiKey {
+	return ApiKey{
+		KeyID:           dbKey.KeyID,
+		Name:            dbKey.Name,
+		Prefix:          dbKey.Prefix,
+		Scopes:          strings.Split(dbKey.Scopes, ","),
+		DailyCrawlQuota: dbKey.DailyCrawlQuota,
+		CreatedAt:       dbKey.CreatedAt,
+	}
+}
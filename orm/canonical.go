@@ -0,0 +1,139 @@
+package orm
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/weppos/publicsuffix-go/publicsuffix"
+	"golang.org/x/net/idna"
+)
+
+var ErrInvalidUrl = errors.New("invalid url")
+
+// trackingParams are the query parameters added by marketing tools, they never change the page
+var trackingParams = []string{"gclid", "fbclid", "msclkid", "yclid", "igshid", "mc_cid", "mc_eid", "_ga"}
+
+// CanonicalUrl returns the url every spelling of the same website is saved as, e.g
+// HTTP://WWW.Korben.info:80/?utm_source=x becomes http://korben.info. The scheme is kept, the
+// websites only served over http would not be reachable otherwise.
+func CanonicalUrl(rawUrl string) (string, error) {
+	rawUrl = strings.TrimSpace(rawUrl)
+	if !strings.Contains(rawUrl, "://") {
+		rawUrl = "http://" + rawUrl
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Hostname() == "" {
+		return "", ErrInvalidUrl
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, err := idna.ToASCII(strings.TrimSuffix(strings.ToLower(u.Hostname()), "."))
+	if err != nil {
+		return "", ErrInvalidUrl
+	}
+	host = strings.TrimPrefix(host, "www.")
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		// an ipv6 address
+		host = "[" + host + "]"
+	}
+	u.Host = host
+
+	query := u.Query()
+	for param := range query {
+		if isTrackingParam(param) {
+			query.Del(param)
+		}
+	}
+	u.RawQuery = query.Encode()
+	u.Path = strings.TrimRight(u.Path, "/")
+	if u.Path == "" && u.RawQuery != "" {
+		u.Path = "/"
+	}
+	u.RawPath = ""
+	u.Fragment = ""
+	u.User = nil
+	return u.String(), nil
+}
+
+func isTrackingParam(param string) bool {
+	param = strings.ToLower(param)
+	if strings.HasPrefix(param, "utm_") {
+		return true
+	}
+	for _, tracking := range trackingParams {
+		if param == tracking {
+			return true
+		}
+	}
+	return false
+}
+
+// sharedDomains host the websites of many people on their subdomains, e.g alice.substack.com, the
+// subdomain is then the domain key
+var sharedDomains = map[string]bool{
+	"medium.com":      true,
+	"substack.com":    true,
+	"wordpress.com":   true,
+	"tumblr.com":      true,
+	"wixsite.com":     true,
+	"weebly.com":      true,
+	"squarespace.com": true,
+	"webflow.io":      true,
+	"netlify.app":     true,
+	"ghost.io":        true,
+	"notion.site":     true,
+}
+
+// profileHosts host the pages of many people on their paths, e.g medium.com/@alice, it is the number
+// of path segments naming the person which are kept in the domain key
+var profileHosts = map[string]int{
+	"medium.com":       1,
+	"sites.google.com": 2,
+	"linktr.ee":        1,
+	"about.me":         1,
+	"notion.so":        1,
+	"github.com":       1,
+	"facebook.com":     1,
+	"twitter.com":      1,
+	"instagram.com":    1,
+	"linkedin.com":     2,
+}
+
+// DomainKey returns the registrable domain of a url, e.g korben.info for https://blog.korben.info/a,
+// the prospects are unique per domain key. It is the host for the ip addresses and the hosts
+// without a public suffix, e.g localhost. The domains shared by many people keep what names the
+// person instead, e.g alice.substack.com or medium.com/@alice.
+func DomainKey(rawUrl string) string {
+	canonical, err := CanonicalUrl(rawUrl)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(rawUrl))
+	}
+	u, _ := url.Parse(canonical)
+	host := u.Hostname()
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	if segments, found := profileHosts[host]; found {
+		path := strings.Split(strings.Trim(strings.ToLower(u.Path), "/"), "/")
+		if len(path) >= segments && path[0] != "" {
+			return host + "/" + strings.Join(path[:segments], "/")
+		}
+		return host
+	}
+	domain, err := publicsuffix.Domain(host)
+	if err != nil {
+		return host
+	}
+	if sharedDomains[domain] {
+		return host
+	}
+	return domain
+}
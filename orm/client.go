@@ -1,20 +1,33 @@
 package orm
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/arthurgustin/openbuzz/shared"
 	"github.com/golang-plus/uuid"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"strings"
+	"time"
 )
 
-var ErrFailedToConnectToDabase = errors.New("failed to connect database")
+var (
+	ErrFailedToConnectToDabase = errors.New("failed to connect database")
+	ErrProspectNotFound        = errors.New("prospect not found")
+	ErrProspectAlreadyExists   = errors.New("a prospect already exists for this domain")
+)
 
 type Client struct {
-	Db     *gorm.DB
-	Logger shared.LoggerInterface `inject:""`
-	Config *shared.AppConfig      `inject:""`
+	Db       *gorm.DB
+	Logger   shared.LoggerInterface `inject:""`
+	Config   *shared.AppConfig      `inject:""`
+	Observer Observer               `inject:""`
+	// actor is who the changes are recorded for in the history, see WithActor
+	actor Actor
+	// notifications are the observer calls waiting for the commit of the transaction of the
+	// client, nil outside of a transaction, see transaction
+	notifications *[]func()
 }
 
 func (c *Client) Init() error {
@@ -34,8 +47,22 @@ func (c *Client) Init() error {
 	// Migrate the schema
 	db.AutoMigrate(&dbProspectInfo{})
 	db.AutoMigrate(&dbProspect{})
+	db.AutoMigrate(&dbCrawlJob{})
+	db.AutoMigrate(&dbCrawlJobItem{})
+	db.AutoMigrate(&dbWebhook{})
+	db.AutoMigrate(&dbWebhookDelivery{})
+	db.AutoMigrate(&dbApiKey{})
+	db.AutoMigrate(&dbApiKeyUsage{})
+	db.AutoMigrate(&dbProspectHistory{})
+	db.AutoMigrate(&dbCrawlReport{})
+	db.AutoMigrate(&dbCrawlChange{})
+	db.AutoMigrate(&dbProspectAlias{})
+	db.AutoMigrate(&dbMigration{})
 	c.Db = db
-	return err
+	if err := c.migrate(); err != nil {
+		return err
+	}
+	return c.migrateSearch()
 }
 
 func (c *Client) getInfoToIgnore(p *Prospect) []int {
@@ -50,27 +77,101 @@ func (c *Client) getInfoToIgnore(p *Prospect) []int {
 	return toIgnore
 }
 
-func (c *Client) Save(p *Prospect) error {
-	p.prospect.ProspectID = c.getOrCreateProspectId(p.GetUrl())
+// Create saves a new prospect, it fails if a prospect already has the domain of the url
+func (c *Client) Create(p *Prospect) error {
+	return c.transaction(func(tx *Client) error {
+		_, found, err := tx.findByDomain(p.GetDomainKey())
+		if err != nil {
+			return err
+		}
+		if found {
+			return ErrProspectAlreadyExists
+		}
+		created, err := tx.save(p)
+		if err == nil && !created {
+			// created at the same time by another request
+			return ErrProspectAlreadyExists
+		}
+		return err
+	})
+}
 
-	if err := c.saveDbProspect(p.prospect); err != nil {
+// Save creates the prospect unless its domain is known and adds the informations it does not have
+// yet, in one transaction
+func (c *Client) Save(p *Prospect) error {
+	return c.transaction(func(tx *Client) error {
+		_, err := tx.save(p)
 		return err
+	})
+}
+
+func (c *Client) save(p *Prospect) (created bool, err error) {
+	p.prospect.ProspectID = c.getOrCreateProspectId(p.GetDomainKey())
+	created, err = c.saveDbProspect(&p.prospect)
+	if err != nil {
+		return
+	}
+	p.ProspectId = p.prospect.ProspectID
+
+	if created {
+		history := []dbProspectHistory{{ProspectID: p.ProspectId, Action: HistoryCreate, Field: "url", NewValue: p.GetUrl()}}
+		names := [][2]string{{"firstName", p.GetFirstName()}, {"middleName", p.GetMiddleName()}, {"lastName", p.GetLastName()}}
+		for _, name := range names {
+			if name[1] != "" {
+				history = append(history, dbProspectHistory{ProspectID: p.ProspectId, Action: HistoryCreate, Field: name[0], NewValue: name[1]})
+			}
+		}
+		if err = c.record(c.Db, history...); err != nil {
+			return
+		}
+		prospect := *p
+		c.notify(func() { c.Observer.ProspectCreated(prospect) })
+	} else if p.prospect.LastCrawledAt != nil {
+		// not an edit of the prospect, the update date is left untouched
+		if err = c.Db.Model(&dbProspect{}).
+			Where("prospect_id = ?", p.ProspectId).
+			UpdateColumn("last_crawled_at", p.prospect.LastCrawledAt).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			return
+		}
 	}
 
+	err = c.saveInfos(p)
+	return
+}
+
+// saveInfos adds the informations of the prospect it does not have yet. An information entered by
+// hand again is validated, even if it was rejected before.
+func (c *Client) saveInfos(p *Prospect) error {
 	duplicatedInfos := c.getInfoToIgnore(p)
 
 	for i, info := range p.infos {
 		if contains(duplicatedInfos, i) {
 			continue
 		}
-		info.ProspectID = p.prospect.ProspectID
-		if c.infoExist(info) {
+		info.ProspectID = p.ProspectId
+		existing, found, err := c.findInfo(info)
+		if err != nil {
+			return err
+		}
+		if found {
+			if info.ValidatedByUser && (!existing.ValidatedByUser || existing.Rejected) {
+				if err := c.validateInfo(existing); err != nil {
+					return err
+				}
+				continue
+			}
 			c.Logger.Info("prospect information already exists", "key", info.Key, "val", info.Val)
 			continue
 		}
 		if err := c.Db.Create(&info).Error; err != nil {
 			return err
 		}
+		if err := c.record(c.Db, infoHistory(info, HistoryCreate, "", info.Val)); err != nil {
+			return err
+		}
+		prospect, added := *p, toProspectInfo(info)
+		c.notify(func() { c.Observer.InfoAdded(prospect, added) })
 	}
 
 	return nil
@@ -85,180 +186,229 @@ func contains(l []int, v int) bool {
 	return false
 }
 
-func (c *Client) Delete(prospectId string) (err error) {
-	transaction := c.Db.Begin()
-	if err = transaction.Model(&dbProspect{}).Delete(&dbProspect{}, "prospect_id = ?", prospectId).Error; err != nil {
-		c.Logger.Warn(err.Error())
-		transaction.Rollback()
+// Delete moves a prospect and its informations to the trash, see Restore
+func (c *Client) Delete(prospectId string) error {
+	// the informations share the deletion date of the prospect so that Restore only brings back
+	// the ones deleted with it
+	now := time.Now()
+	return c.transaction(func(tx *Client) error {
+		res := tx.Db.Model(&dbProspect{}).Where("prospect_id = ?", prospectId).UpdateColumn("deleted_at", now)
+		if err := res.Error; err != nil {
+			c.Logger.Warn(err.Error())
+			return err
+		}
+		if res.RowsAffected == 0 {
+			return ErrProspectNotFound
+		}
+
+		if err := tx.Db.Model(&dbProspectInfo{}).Where("prospect_id = ?", prospectId).UpdateColumn("deleted_at", now).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			return err
+		}
+		if err := tx.record(tx.Db, dbProspectHistory{ProspectID: prospectId, Action: HistoryDelete}); err != nil {
+			return err
+		}
+		tx.notify(func() { c.Observer.ProspectDeleted(prospectId) })
+		return nil
+	})
+}
+
+// List returns a page of the prospects matching the options and the total number of matching prospects
+func (c *Client) List(opts ListOptions) (list []Prospect, total int, err error) {
+	if err = opts.Validate(); err != nil {
 		return
 	}
 
-	if err = transaction.Model(&dbProspectInfo{}).Delete(&dbProspect{}, "prospect_id = ?", prospectId).Error; err != nil {
+	query := c.filterProspects(c.Db.Model(&dbProspect{}), opts)
+	if err = query.Count(&total).Error; err != nil {
 		c.Logger.Warn(err.Error())
-		transaction.Rollback()
 		return
 	}
-	transaction.Commit()
-	return
-}
 
-func (c *Client) List() (list []Prospect, err error) {
 	allProspects := []dbProspect{}
-
-	if err = c.Db.Model(&dbProspect{}).Find(&allProspects).Error; err != nil {
+	if err = paginate(c.sortProspects(query, opts), opts).Find(&allProspects).Error; err != nil {
 		c.Logger.Warn(err.Error())
 		return
 	}
 
-	for _, prospect := range allProspects {
-		prospectsInfo := []dbProspectInfo{}
-
-		if err = c.Db.Model(&dbProspectInfo{}).
-			Where("prospect_id = ?", prospect.ProspectID).
-			Find(&prospectsInfo).Error; err != nil {
-			c.Logger.Warn(err.Error())
-			return
-		}
-
-		list = append(list, Prospect{
-			ProspectId: prospect.ProspectID,
-			prospect:   prospect,
-			infos:      prospectsInfo,
-		})
-	}
+	list, err = c.loadInfos(allProspects)
 	return
 }
 
-func (c *Client) GetEmails(prospectId string) (emails []Email, err error) {
-	infos := []dbProspectInfo{}
-
-	if err = c.Db.Model(&dbProspectInfo{}).
-		Where("prospect_id = ? AND key = ?", prospectId, "email").
-		Find(&infos).Error; err != nil {
+func (c *Client) Get(prospectId string) (prospect Prospect, err error) {
+	dbPro := dbProspect{}
+	if err = c.Db.Model(&dbProspect{}).Where("prospect_id = ?", prospectId).First(&dbPro).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return prospect, ErrProspectNotFound
+		}
 		c.Logger.Warn(err.Error())
 		return
 	}
 
-	for _, info := range infos {
-		emails = append(emails, Email{
-			Email:           info.Val,
-			Confidence:      info.Confidence,
-			ValidatedByUser: info.ValidatedByUser,
-		})
+	list, err := c.loadInfos([]dbProspect{dbPro})
+	if err != nil {
+		return
 	}
-	return
+	return list[0], nil
 }
 
-func (c *Client) GetSocialMedia(prospectId string) (socialMedias []SocialMedia, err error) {
-
-	for _, socialMedia := range allSocialMedia {
-		infos := []dbProspectInfo{}
-
-		if err = c.Db.Model(&dbProspectInfo{}).
-			Where("prospect_id = ? AND key = ?", prospectId, socialMedia).
-			Order("confidence desc").
-			Limit(1).
-			Find(&infos).Error; err != nil {
-			c.Logger.Warn(err.Error())
-			return
+func (c *Client) SetNames(prospectId, firstName, middleName, lastName string) error {
+	existing := dbProspect{}
+	if err := c.Db.Model(&dbProspect{}).Where("prospect_id = ?", prospectId).First(&existing).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return ErrProspectNotFound
 		}
+		c.Logger.Warn(err.Error())
+		return err
+	}
 
-		for _, info := range infos {
-			socialMedias = append(socialMedias, SocialMedia{
-				Name:            info.Key,
-				Url:             info.Val,
-				Confidence:      info.Confidence,
-				ValidatedByUser: info.ValidatedByUser,
-			})
+	names := []struct{ field, old, new string }{
+		{"firstName", existing.FirstName, strings.ToLower(firstName)},
+		{"middleName", existing.MiddleName, strings.ToLower(middleName)},
+		{"lastName", existing.LastName, strings.ToLower(lastName)},
+	}
+	history := []dbProspectHistory{}
+	for _, name := range names {
+		if name.old != name.new {
+			history = append(history, dbProspectHistory{ProspectID: prospectId, Action: HistoryUpdate, Field: name.field, OldValue: name.old, NewValue: name.new})
 		}
 	}
 
-	return
+	return c.transaction(func(tx *Client) error {
+		if err := tx.Db.Model(&dbProspect{}).
+			Where("prospect_id = ?", prospectId).
+			Updates(map[string]interface{}{
+				"first_name":  names[0].new,
+				"middle_name": names[1].new,
+				"last_name":   names[2].new,
+			}).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			return err
+		}
+		return tx.record(tx.Db, history...)
+	})
 }
 
-func (c *Client) GetAssets(prospectId string) (assets Assets, err error) {
-	infos := []dbProspectInfo{}
+// transaction calls fn with a client whose queries run in one transaction, committed when fn
+// succeeds. The methods called on tx join its transaction and the observer is notified once it is
+// committed.
+func (c *Client) transaction(fn func(tx *Client) error) error {
+	if c.notifications != nil {
+		return fn(c)
+	}
 
-	if err = c.Db.Model(&dbProspectInfo{}).
-		Where("prospect_id = ? AND key = ?", prospectId, "icon").
-		Find(&infos).Error; err != nil {
+	tx := *c
+	tx.Db = c.Db.Begin()
+	if err := tx.Db.Error; err != nil {
 		c.Logger.Warn(err.Error())
-		return
+		return err
 	}
-
-	for _, info := range infos {
-		assets.Icons = append(assets.Icons, Icon{
-			Link: info.Val,
-		})
+	tx.notifications = &[]func(){}
+	if err := fn(&tx); err != nil {
+		tx.Db.Rollback()
+		return err
 	}
-	return
+	if err := tx.Db.Commit().Error; err != nil {
+		return err
+	}
+	for _, notification := range *tx.notifications {
+		notification()
+	}
+	return nil
 }
 
-func (c *Client) GetTags(prospectId string) (tags []Tag, err error) {
-	infos := []dbProspectInfo{}
-
-	if err = c.Db.Model(&dbProspectInfo{}).
-		Where("prospect_id = ? AND key = ?", prospectId, "tag").
-		Find(&infos).Error; err != nil {
-		c.Logger.Warn(err.Error())
+// notify calls the observer, once the transaction is committed when the client is in one
+func (c *Client) notify(notification func()) {
+	if c.notifications != nil {
+		*c.notifications = append(*c.notifications, notification)
 		return
 	}
+	notification()
+}
 
-	for _, info := range infos {
-		tags = append(tags, Tag(info.Val))
-	}
-	return
+func (c *Client) GetEmails(prospectId string) (emails []Email, err error) {
+	infos, err := c.getInfos(prospectId, "email")
+	return emailsFromInfos(infos), err
+}
+
+func (c *Client) GetSocialMedia(prospectId string) (socialMedias []SocialMedia, err error) {
+	infos, err := c.getInfos(prospectId, allSocialMedia...)
+	return socialMediaFromInfos(infos), err
+}
+
+func (c *Client) GetAssets(prospectId string) (assets Assets, err error) {
+	infos, err := c.getInfos(prospectId, "icon")
+	return assetsFromInfos(infos), err
+}
+
+func (c *Client) GetTags(prospectId string) (tags []Tag, err error) {
+	infos, err := c.getInfos(prospectId, "tag")
+	return tagsFromInfos(infos), err
 }
 
 func (c *Client) GetDescription(prospectId string) (desc string, err error) {
-	infos := []dbProspectInfo{}
+	infos, err := c.getInfos(prospectId, "description")
+	return descriptionFromInfos(infos), err
+}
 
+func (c *Client) getInfos(prospectId string, keys ...string) (infos []dbProspectInfo, err error) {
 	if err = c.Db.Model(&dbProspectInfo{}).
-		Where("prospect_id = ? AND key = ?", prospectId, "description").
-		Limit(1).
+		Where("prospect_id = ? AND key IN (?) AND NOT rejected", prospectId, keys).
+		Order("id").
 		Find(&infos).Error; err != nil {
 		c.Logger.Warn(err.Error())
-		return
-	}
-
-	for _, info := range infos {
-		return info.Val, nil
 	}
 	return
 }
 
-func (c *Client) saveDbProspect(p dbProspect) error {
-	pro := dbProspect{}
-	if notFound := c.Db.Model(&dbProspect{}).
-		Where("url = ?", p.Url).Scan(&pro).RecordNotFound(); !notFound {
-		return nil
+// saveDbProspect creates the prospect unless its domain is already known, the id of the prospect
+// is then replaced by the one of the known prospect
+func (c *Client) saveDbProspect(p *dbProspect) (created bool, err error) {
+	existing, found, err := c.findByDomain(p.DomainKey)
+	if err != nil {
+		return false, err
+	}
+	if found {
+		p.ProspectID = existing.ProspectID
+		return false, nil
 	}
 
-	if err := c.Db.Model(&dbProspect{}).Create(&p).Error; err != nil {
-		return err
+	// the unique index of the domain keys lets only one of the prospects created at the same time in,
+	// nothing is returned for the other ones
+	toCreate := *p
+	if err = c.Db.Model(&dbProspect{}).Set("gorm:insert_option", "ON CONFLICT DO NOTHING").Create(&toCreate).Error; err != nil && err != sql.ErrNoRows {
+		c.Logger.Warn(err.Error())
+		return false, err
 	}
-	return nil
+	if existing, found, err = c.findByDomain(p.DomainKey); err != nil {
+		return false, err
+	}
+	if !found {
+		return false, ErrProspectNotFound
+	}
+	created = existing.ProspectID == p.ProspectID
+	p.ProspectID = existing.ProspectID
+	return created, nil
 }
 
-func (c *Client) infoExist(info dbProspectInfo) bool {
-	var count int
-	if err := c.Db.Model(&dbProspectInfo{}).
+// findInfo also matches the rejected informations so that they are never added again
+func (c *Client) findInfo(info dbProspectInfo) (existing dbProspectInfo, found bool, err error) {
+	err = c.Db.Model(&dbProspectInfo{}).
 		Where("key = ? AND val = ? AND prospect_id = ?", info.Key, info.Val, info.ProspectID).
-		Count(&count).Error; err != nil {
-		panic(err)
+		Order("id").
+		First(&existing).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return existing, false, nil
 	}
-	if count > 0 {
-		return true
+	if err != nil {
+		c.Logger.Warn(err.Error())
+		return
 	}
-	return false
+	return existing, true, nil
 }
 
-func (c *Client) getOrCreateProspectId(url string) string {
-	var prospect dbProspect
-	c.Db.Model(&dbProspect{}).
-		Where("url = ?", url).First(&prospect)
-
-	if prospect.Url != "" {
+func (c *Client) getOrCreateProspectId(domainKey string) string {
+	if prospect, found, _ := c.findByDomain(domainKey); found {
 		return prospect.ProspectID
 	}
 
@@ -0,0 +1,349 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-plus/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	CrawlStateQueued  = "queued"
+	CrawlStateRunning = "running"
+	CrawlStateDone    = "done"
+	CrawlStateFailed  = "failed"
+)
+
+var (
+	ErrCrawlJobNotFound  = errors.New("crawl job not found")
+	ErrCrawlLeaseExpired = errors.New("crawl lease is not owned anymore")
+)
+
+type dbCrawlJob struct {
+	gorm.Model
+	JobID string `gorm:"not null;unique"`
+}
+
+type dbCrawlJobItem struct {
+	gorm.Model
+	JobID string `gorm:"not null;index"`
+	Url   string `gorm:"not null"`
+	// DomainKey is the one of the prospect of the url, see DomainKey
+	DomainKey  string `gorm:"index"`
+	State      string `gorm:"not null"`
+	Reason     string
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+	// Result is what the crawl extracted, json encoded
+	Result string `gorm:"type:text"`
+	// What to crawl, see CrawlTarget
+	FirstName         string
+	MiddleName        string
+	LastName          string
+	MaxDepth          int
+	TimeBudget        time.Duration
+	SkipEmailGuessing bool
+	// Queue bookkeeping: a worker owns the item until its lease expires,
+	// it has to send heartbeats to keep it while crawling
+	Attempts       int
+	LeaseOwner     string
+	LeaseExpiresAt *time.Time `gorm:"index"`
+	HeartbeatAt    *time.Time
+}
+
+type CrawlJob struct {
+	JobID     string
+	CreatedAt time.Time
+	Items     []CrawlJobItem
+}
+
+// CrawlTarget is a url to crawl with what we already know about it. Zero values of the options
+// mean the crawler defaults.
+type CrawlTarget struct {
+	Url               string
+	FirstName         string
+	MiddleName        string
+	LastName          string
+	MaxDepth          int
+	TimeBudget        time.Duration
+	SkipEmailGuessing bool
+}
+
+type CrawlJobItem struct {
+	CrawlTarget
+	ItemID     uint
+	JobID      string
+	State      string
+	Reason     string
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+	Attempts   int
+	Result     string
+}
+
+type CrawlBacklog struct {
+	Queued  int
+	Running int
+}
+
+// IsFinished returns true when every url of the job has been either crawled or has failed
+func (j CrawlJob) IsFinished() bool {
+	for _, item := range j.Items {
+		if item.State == CrawlStateQueued || item.State == CrawlStateRunning {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Client) CreateCrawlJob(targets []CrawlTarget) (job CrawlJob, err error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return
+	}
+
+	transaction := c.Db.Begin()
+	dbJob := dbCrawlJob{
+		JobID: id.String(),
+	}
+	if err = transaction.Create(&dbJob).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		transaction.Rollback()
+		return
+	}
+
+	items := []dbCrawlJobItem{}
+	for _, target := range targets {
+		item := dbCrawlJobItem{
+			JobID:             dbJob.JobID,
+			Url:               target.Url,
+			DomainKey:         DomainKey(target.Url),
+			State:             CrawlStateQueued,
+			FirstName:         target.FirstName,
+			MiddleName:        target.MiddleName,
+			LastName:          target.LastName,
+			MaxDepth:          target.MaxDepth,
+			TimeBudget:        target.TimeBudget,
+			SkipEmailGuessing: target.SkipEmailGuessing,
+		}
+		if err = transaction.Create(&item).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			transaction.Rollback()
+			return
+		}
+		items = append(items, item)
+	}
+	if err = transaction.Commit().Error; err != nil {
+		return
+	}
+
+	return toCrawlJob(dbJob, items), nil
+}
+
+func (c *Client) GetCrawlJob(jobId string) (job CrawlJob, err error) {
+	dbJob := dbCrawlJob{}
+	if err = c.Db.Model(&dbCrawlJob{}).Where("job_id = ?", jobId).First(&dbJob).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return job, ErrCrawlJobNotFound
+		}
+		c.Logger.Warn(err.Error())
+		return
+	}
+
+	items := []dbCrawlJobItem{}
+	if err = c.Db.Model(&dbCrawlJobItem{}).
+		Where("job_id = ?", jobId).
+		Order("id").
+		Find(&items).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+
+	return toCrawlJob(dbJob, items), nil
+}
+
+// ClaimCrawlJobItem leases the oldest queued item to the given owner. Items whose lease expired
+// (e.g. the process crawling them died) are claimable again until they reach maxAttempts.
+// It returns false when there is nothing to crawl.
+func (c *Client) ClaimCrawlJobItem(owner string, lease time.Duration, maxAttempts int) (item CrawlJobItem, claimed bool, err error) {
+	now := time.Now()
+	table := c.Db.NewScope(&dbCrawlJobItem{}).TableName()
+
+	// Items that were abandoned too many times are not going to succeed
+	if err = c.Db.Model(&dbCrawlJobItem{}).
+		Where("state = ? AND lease_expires_at < ? AND attempts >= ?", CrawlStateRunning, now, maxAttempts).
+		Updates(map[string]interface{}{
+			"state":       CrawlStateFailed,
+			"reason":      "crawl abandoned too many times",
+			"finished_at": &now,
+			"lease_owner": "",
+		}).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+
+	expiresAt := now.Add(lease)
+	rows, err := c.Db.Raw(fmt.Sprintf(`UPDATE %[1]s SET
+			state = ?, lease_owner = ?, lease_expires_at = ?, heartbeat_at = ?,
+			started_at = ?, attempts = attempts + 1, updated_at = ?
+		WHERE id = (
+			SELECT id FROM %[1]s
+			WHERE deleted_at IS NULL AND (state = ? OR (state = ? AND lease_expires_at < ?))
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id`, table),
+		CrawlStateRunning, owner, expiresAt, now, now, now,
+		CrawlStateQueued, CrawlStateRunning, now).Rows()
+	if err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+	defer rows.Close()
+
+	var id uint
+	if !rows.Next() {
+		return item, false, rows.Err()
+	}
+	if err = rows.Scan(&id); err != nil {
+		return
+	}
+	rows.Close()
+
+	dbItem := dbCrawlJobItem{}
+	if err = c.Db.Model(&dbCrawlJobItem{}).Where("id = ?", id).First(&dbItem).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+	return toCrawlJobItem(dbItem), true, nil
+}
+
+// HeartbeatCrawlJobItem extends the lease of an item being crawled
+func (c *Client) HeartbeatCrawlJobItem(itemId uint, owner string, lease time.Duration) error {
+	now := time.Now()
+	return c.updateLeasedCrawlJobItem(itemId, owner, map[string]interface{}{
+		"heartbeat_at":     &now,
+		"lease_expires_at": now.Add(lease),
+	})
+}
+
+func (c *Client) CompleteCrawlJobItem(itemId uint, owner, result string) error {
+	now := time.Now()
+	return c.updateLeasedCrawlJobItem(itemId, owner, map[string]interface{}{
+		"state":       CrawlStateDone,
+		"reason":      "",
+		"result":      result,
+		"finished_at": &now,
+		"lease_owner": "",
+	})
+}
+
+func (c *Client) FailCrawlJobItem(itemId uint, owner, reason string) error {
+	now := time.Now()
+	return c.updateLeasedCrawlJobItem(itemId, owner, map[string]interface{}{
+		"state":       CrawlStateFailed,
+		"reason":      reason,
+		"finished_at": &now,
+		"lease_owner": "",
+	})
+}
+
+// RetryCrawlJobItem puts back an item in the queue after a failed attempt
+func (c *Client) RetryCrawlJobItem(itemId uint, owner, reason string) error {
+	return c.updateLeasedCrawlJobItem(itemId, owner, map[string]interface{}{
+		"state":            CrawlStateQueued,
+		"reason":           reason,
+		"lease_owner":      "",
+		"lease_expires_at": nil,
+	})
+}
+
+func (c *Client) updateLeasedCrawlJobItem(itemId uint, owner string, values map[string]interface{}) error {
+	res := c.Db.Model(&dbCrawlJobItem{}).
+		Where("id = ? AND lease_owner = ?", itemId, owner).
+		Updates(values)
+	if res.Error != nil {
+		c.Logger.Warn(res.Error.Error())
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrCrawlLeaseExpired
+	}
+	return nil
+}
+
+// CrawlBacklog counts the urls waiting to be crawled and the ones being crawled
+func (c *Client) CrawlBacklog() (backlog CrawlBacklog, err error) {
+	if err = c.Db.Model(&dbCrawlJobItem{}).
+		Where("state = ?", CrawlStateQueued).
+		Count(&backlog.Queued).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+
+	if err = c.Db.Model(&dbCrawlJobItem{}).
+		Where("state = ?", CrawlStateRunning).
+		Count(&backlog.Running).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+	return
+}
+
+// AcknowledgeCrawlJob removes a job and the status of its urls, the job won't be reachable anymore
+func (c *Client) AcknowledgeCrawlJob(jobId string) (err error) {
+	transaction := c.Db.Begin()
+	res := transaction.Delete(&dbCrawlJob{}, "job_id = ?", jobId)
+	if err = res.Error; err != nil {
+		c.Logger.Warn(err.Error())
+		transaction.Rollback()
+		return
+	}
+	if res.RowsAffected == 0 {
+		transaction.Rollback()
+		return ErrCrawlJobNotFound
+	}
+
+	if err = transaction.Delete(&dbCrawlJobItem{}, "job_id = ?", jobId).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		transaction.Rollback()
+		return
+	}
+	return transaction.Commit().Error
+}
+
+func toCrawlJob(dbJob dbCrawlJob, items []dbCrawlJobItem) CrawlJob {
+	job := CrawlJob{
+		JobID:     dbJob.JobID,
+		CreatedAt: dbJob.CreatedAt,
+	}
+	for _, item := range items {
+		job.Items = append(job.Items, toCrawlJobItem(item))
+	}
+	return job
+}
+
+func toCrawlJobItem(item dbCrawlJobItem) CrawlJobItem {
+	return CrawlJobItem{
+		CrawlTarget: CrawlTarget{
+			Url:               item.Url,
+			FirstName:         item.FirstName,
+			MiddleName:        item.MiddleName,
+			LastName:          item.LastName,
+			MaxDepth:          item.MaxDepth,
+			TimeBudget:        item.TimeBudget,
+			SkipEmailGuessing: item.SkipEmailGuessing,
+		},
+		ItemID:     item.ID,
+		JobID:      item.JobID,
+		State:      item.State,
+		Reason:     item.Reason,
+		StartedAt:  item.StartedAt,
+		FinishedAt: item.FinishedAt,
+		Attempts:   item.Attempts,
+		Result:     item.Result,
+	}
+}
@@ -0,0 +1,341 @@
+package orm
+
+import (
+	"time"
+
+	"github.com/golang-plus/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeUpdated = "updated"
+)
+
+// singleValuedKeys are the informations a website has only one of, a new value replaces the old one
+var singleValuedKeys = []string{"description"}
+
+// dbCrawlReport is what a crawl changed on a prospect, see SaveCrawl
+type dbCrawlReport struct {
+	gorm.Model
+	ReportID   string `gorm:"not null;unique"`
+	ProspectID string `gorm:"not null;index"`
+	JobID      string
+	// FirstCrawl reports are made of the whole prospect since nothing was crawled before
+	FirstCrawl bool
+	// Partial crawls did not fetch the website, e.g it was down, nothing was removed
+	Partial         bool `gorm:"not null;default:false"`
+	NumberOfChanges int
+}
+
+type dbCrawlChange struct {
+	ID       uint   `gorm:"primary_key"`
+	ReportID string `gorm:"not null;index"`
+	Type     string `gorm:"not null"`
+	// Field is a prospect field, e.g firstName, or the key of an information, e.g email
+	Field    string `gorm:"not null"`
+	OldValue string `gorm:"type:text"`
+	NewValue string `gorm:"type:text"`
+}
+
+type CrawlReport struct {
+	ReportID   string
+	ProspectID string
+	JobID      string
+	FirstCrawl bool
+	Partial    bool
+	Changes    []CrawlChange
+	CreatedAt  time.Time
+}
+
+// CrawlChange is an information added, removed or updated by a crawl, OldValue is empty when it is
+// added and NewValue when it is removed
+type CrawlChange struct {
+	Type     string
+	Field    string
+	OldValue string
+	NewValue string
+}
+
+// SaveCrawl saves what a crawl found about a prospect and reports the differences with what was
+// known before. The informations found by a previous crawl and missing from this one are removed,
+// unless a user validated them, the crawl is partial, e.g the website did not answer, or it is the
+// crawl of an alias of the prospect. Empty names are filled with the ones of the crawl. queuedUrl
+// is the url which was crawled when the website redirected to the one of p, it can be empty.
+func (c *Client) SaveCrawl(p *Prospect, queuedUrl, jobId string, partial bool) (report CrawlReport, err error) {
+	err = c.transaction(func(tx *Client) error {
+		report, err = tx.saveCrawl(p, queuedUrl, jobId, partial)
+		return err
+	})
+	return
+}
+
+func (c *Client) saveCrawl(p *Prospect, queuedUrl, jobId string, partial bool) (report CrawlReport, err error) {
+	// a website redirecting to another domain stays the prospect of the queued url, the domain it
+	// redirects to becomes an alias so that both urls lead to the same prospect
+	redirected := queuedUrl != "" && DomainKey(queuedUrl) != p.GetDomainKey()
+	aliasUrl := ""
+	if redirected {
+		queued, queuedKnown, findErr := c.findByDomain(DomainKey(queuedUrl))
+		if findErr != nil {
+			err = findErr
+			return
+		}
+		aliasUrl = followRedirect(p, queuedUrl, queued, queuedKnown)
+	}
+
+	existing, known, err := c.findByDomain(p.GetDomainKey())
+	if err != nil {
+		return
+	}
+	before := []dbProspectInfo{}
+	if known {
+		// the rejected informations are loaded too, they are never added again so they are not new
+		if err = c.Db.Model(&dbProspectInfo{}).Where("prospect_id = ?", existing.ProspectID).Order("id").Find(&before).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			return
+		}
+	}
+
+	// a partial crawl is not a fresh one, the website is recrawled later, see RecrawlPolicy
+	if !partial {
+		p.SetCrawledAt(time.Now())
+	}
+	if err = c.Save(p); err != nil {
+		return
+	}
+	if aliasUrl != "" {
+		if err = c.addAlias(p.ProspectId, aliasUrl); err != nil {
+			return
+		}
+	}
+
+	report = CrawlReport{
+		ProspectID: p.ProspectId,
+		JobID:      jobId,
+		FirstCrawl: !known || existing.LastCrawledAt == nil,
+		Partial:    partial,
+	}
+	if known {
+		if report.Changes, err = c.fillNames(existing, p); err != nil {
+			return
+		}
+	}
+
+	// the crawl of an alias is another website than the one of the prospect, what it does not find
+	// may still be on the website of the prospect
+	ownWebsite := !known || existing.DomainKey == p.GetDomainKey()
+	infoChanges, removed := diffInfos(before, p.infos, !partial && ownWebsite)
+	if len(removed) > 0 {
+		if err = c.deleteInfos(c.Db.Where("id IN (?)", removed), false); err != nil {
+			return
+		}
+	}
+	report.Changes = append(report.Changes, infoChanges...)
+
+	if err = c.saveCrawlReport(&report); err != nil {
+		return
+	}
+	if known && len(report.Changes) > 0 {
+		prospect, changed := *p, report
+		c.notify(func() { c.Observer.ProspectChanged(prospect, changed) })
+	}
+	return
+}
+
+// followRedirect moves the crawl of a website redirected to another domain onto the prospect of
+// the queued url when there is one. aliasUrl is the url which becomes an alias of the prospect the
+// crawl is saved on.
+func followRedirect(p *Prospect, queuedUrl string, queued dbProspect, queuedKnown bool) (aliasUrl string) {
+	if !queuedKnown {
+		return queuedUrl
+	}
+	aliasUrl = p.GetUrl()
+	p.replaceUrl(queued.Url)
+	return aliasUrl
+}
+
+// fillNames sets the names the prospect does not have yet, the ones a user entered are kept
+func (c *Client) fillNames(existing dbProspect, p *Prospect) (changes []CrawlChange, err error) {
+	names := []struct{ field, old, new string }{
+		{"firstName", existing.FirstName, p.GetFirstName()},
+		{"middleName", existing.MiddleName, p.GetMiddleName()},
+		{"lastName", existing.LastName, p.GetLastName()},
+	}
+	filled := false
+	for i, name := range names {
+		if name.old == "" && name.new != "" {
+			changes = append(changes, CrawlChange{Type: ChangeAdded, Field: name.field, NewValue: name.new})
+			filled = true
+		} else {
+			names[i].new = name.old
+		}
+	}
+	if filled {
+		err = c.SetNames(existing.ProspectID, names[0].new, names[1].new, names[2].new)
+	}
+	return
+}
+
+// diffInfos compares the informations known before a crawl with the ones it found, removed are the
+// ids of the informations which have to be removed. Nothing is removed without removals.
+func diffInfos(before, found []dbProspectInfo, removals bool) (changes []CrawlChange, removed []uint) {
+	known := map[[2]string]bool{}
+	for _, info := range before {
+		known[[2]string{info.Key, info.Val}] = true
+	}
+	isFound := map[[2]string]bool{}
+	added, gone := []dbProspectInfo{}, []dbProspectInfo{}
+	for _, info := range found {
+		k := [2]string{info.Key, info.Val}
+		if !known[k] && !isFound[k] {
+			added = append(added, info)
+		}
+		isFound[k] = true
+	}
+	for _, info := range before {
+		if removals && !isFound[[2]string{info.Key, info.Val}] && crawlOwns(info) {
+			gone = append(gone, info)
+			removed = append(removed, info.ID)
+		}
+	}
+
+	// a single valued information replaced by another is updated rather than removed and added
+	updated := map[string]bool{}
+	for _, key := range singleValuedKeys {
+		a, g := filterKey(added, key), filterKey(gone, key)
+		if len(a) == 1 && len(g) == 1 {
+			changes = append(changes, CrawlChange{Type: ChangeUpdated, Field: key, OldValue: g[0].Val, NewValue: a[0].Val})
+			updated[key] = true
+		}
+	}
+	for _, info := range added {
+		if !updated[info.Key] {
+			changes = append(changes, CrawlChange{Type: ChangeAdded, Field: info.Key, NewValue: info.Val})
+		}
+	}
+	for _, info := range gone {
+		if !updated[info.Key] {
+			changes = append(changes, CrawlChange{Type: ChangeRemoved, Field: info.Key, OldValue: info.Val})
+		}
+	}
+	return
+}
+
+// crawlOwns is true for the informations a crawl is expected to find again. The guessed emails are
+// not, a crawl does not always guess them, nor the ones entered, validated or rejected by a user.
+func crawlOwns(info dbProspectInfo) bool {
+	if info.Key == "domain" || info.Rejected || info.ValidatedByUser {
+		return false
+	}
+	return info.Source == SourceCrawl || info.Source == SourceMailto
+}
+
+func filterKey(infos []dbProspectInfo, key string) (filtered []dbProspectInfo) {
+	for _, info := range infos {
+		if info.Key == key {
+			filtered = append(filtered, info)
+		}
+	}
+	return
+}
+
+func (c *Client) saveCrawlReport(report *CrawlReport) error {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+
+	dbReport := dbCrawlReport{
+		ReportID:        id.String(),
+		ProspectID:      report.ProspectID,
+		JobID:           report.JobID,
+		FirstCrawl:      report.FirstCrawl,
+		Partial:         report.Partial,
+		NumberOfChanges: len(report.Changes),
+	}
+	if err := c.transaction(func(tx *Client) error {
+		if err := tx.Db.Create(&dbReport).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			return err
+		}
+		for _, change := range report.Changes {
+			if err := tx.Db.Create(&dbCrawlChange{
+				ReportID: dbReport.ReportID,
+				Type:     change.Type,
+				Field:    change.Field,
+				OldValue: change.OldValue,
+				NewValue: change.NewValue,
+			}).Error; err != nil {
+				c.Logger.Warn(err.Error())
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	report.ReportID = dbReport.ReportID
+	report.CreatedAt = dbReport.CreatedAt
+	return nil
+}
+
+// GetCrawlReports returns the reports of the crawls of a prospect, most recent first. changedOnly
+// skips the crawls which changed nothing.
+func (c *Client) GetCrawlReports(prospectId string, changedOnly bool, limit, offset int) (reports []CrawlReport, total int, err error) {
+	if _, err = c.Get(prospectId); err != nil {
+		return
+	}
+
+	query := c.Db.Model(&dbCrawlReport{}).Where("prospect_id = ?", prospectId)
+	if changedOnly {
+		query = query.Where("number_of_changes > 0")
+	}
+	if err = query.Count(&total).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+
+	dbReports := []dbCrawlReport{}
+	if err = query.Order("id desc").Limit(limit).Offset(offset).Find(&dbReports).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+	if len(dbReports) == 0 {
+		return
+	}
+
+	ids := []string{}
+	for _, r := range dbReports {
+		ids = append(ids, r.ReportID)
+	}
+	dbChanges := []dbCrawlChange{}
+	if err = c.Db.Model(&dbCrawlChange{}).Where("report_id IN (?)", ids).Order("id").Find(&dbChanges).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+	changes := map[string][]CrawlChange{}
+	for _, change := range dbChanges {
+		changes[change.ReportID] = append(changes[change.ReportID], CrawlChange{
+			Type:     change.Type,
+			Field:    change.Field,
+			OldValue: change.OldValue,
+			NewValue: change.NewValue,
+		})
+	}
+
+	for _, r := range dbReports {
+		reports = append(reports, CrawlReport{
+			ReportID:   r.ReportID,
+			ProspectID: r.ProspectID,
+			JobID:      r.JobID,
+			FirstCrawl: r.FirstCrawl,
+			Partial:    r.Partial,
+			Changes:    changes[r.ReportID],
+			CreatedAt:  r.CreatedAt,
+		})
+	}
+	return
+}
@@ -0,0 +1,121 @@
+package orm
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func domainInfos(p *Prospect) (values []string) {
+	for _, info := range p.GetInfos() {
+		if info.Key == "domain" {
+			values = append(values, info.Val)
+		}
+	}
+	return
+}
+
+func TestFollowRedirectToKnownDomain(t *testing.T) {
+	// http://korben.info was queued and redirected to https://korben.fr, korben.info is a prospect
+	p := NewProspect("https://korben.fr").SetDescription("the blog of korben")
+	queued := dbProspect{ProspectID: "queued", Url: "http://korben.info", DomainKey: "korben.info"}
+
+	aliasUrl := followRedirect(p, "http://korben.info/", queued, true)
+
+	assert.Equal(t, "https://korben.fr", aliasUrl)
+	assert.Equal(t, "http://korben.info", p.GetUrl())
+	assert.Equal(t, "korben.info", p.GetDomainKey())
+	assert.Equal(t, []string{"http://korben.info"}, domainInfos(p))
+	assert.Len(t, p.GetInfos(), 2)
+}
+
+func TestFollowRedirectToUnknownDomain(t *testing.T) {
+	p := NewProspect("https://korben.fr")
+
+	aliasUrl := followRedirect(p, "http://korben.info/", dbProspect{}, false)
+
+	assert.Equal(t, "http://korben.info/", aliasUrl)
+	assert.Equal(t, "https://korben.fr", p.GetUrl())
+	assert.Equal(t, []string{"https://korben.fr"}, domainInfos(p))
+}
+
+func TestCrawlOwns(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		info     dbProspectInfo
+		expected bool
+	}{
+		{"crawled", dbProspectInfo{Key: "twitter", Source: SourceCrawl}, true},
+		{"mailto link", dbProspectInfo{Key: "email", Source: SourceMailto}, true},
+		{"guessed email", dbProspectInfo{Key: "email", Source: SourceSmtp}, false},
+		{"entered by a user", dbProspectInfo{Key: "tag", Source: SourceUser}, false},
+		{"merged", dbProspectInfo{Key: "twitter", Source: SourceMerge}, false},
+		{"validated", dbProspectInfo{Key: "twitter", Source: SourceCrawl, ValidatedByUser: true}, false},
+		{"rejected", dbProspectInfo{Key: "twitter", Source: SourceCrawl, Rejected: true}, false},
+		{"domain", dbProspectInfo{Key: "domain", Source: SourceCrawl}, false},
+	} {
+		assert.Equal(t, test.expected, crawlOwns(test.info), test.name)
+	}
+}
+
+func TestDiffInfos(t *testing.T) {
+	info := func(id uint, key, val, source string) dbProspectInfo {
+		return dbProspectInfo{Model: gorm.Model{ID: id}, Key: key, Val: val, Source: source}
+	}
+	validated := info(5, "twitter", "https://twitter.com/korben", SourceCrawl)
+	validated.ValidatedByUser = true
+	rejected := info(6, "email", "spam@korben.info", SourceCrawl)
+	rejected.Rejected = true
+	before := []dbProspectInfo{
+		info(1, "domain", "http://korben.info", SourceCrawl),
+		info(2, "description", "the old one", SourceCrawl),
+		info(3, "email", "contact@korben.info", SourceMailto),
+		info(4, "email", "korben@korben.info", SourceSmtp),
+		validated,
+		rejected,
+		info(7, "tag", "blog", SourceCrawl),
+	}
+
+	for _, test := range []struct {
+		name     string
+		found    []dbProspectInfo
+		removals bool
+		changes  []CrawlChange
+		removed  []uint
+	}{
+		{
+			name:     "nothing changed",
+			found:    []dbProspectInfo{info(0, "description", "the old one", SourceCrawl), info(0, "email", "contact@korben.info", SourceMailto), info(0, "tag", "blog", SourceCrawl)},
+			removals: true,
+		},
+		{
+			name: "added, updated and removed",
+			found: []dbProspectInfo{
+				info(0, "description", "the new one", SourceCrawl),
+				info(0, "tag", "news", SourceCrawl),
+				info(0, "tag", "news", SourceCrawl),
+				// rejected before, it is not new
+				info(0, "email", "spam@korben.info", SourceCrawl),
+			},
+			removals: true,
+			changes: []CrawlChange{
+				{Type: ChangeUpdated, Field: "description", OldValue: "the old one", NewValue: "the new one"},
+				{Type: ChangeAdded, Field: "tag", NewValue: "news"},
+				{Type: ChangeRemoved, Field: "email", OldValue: "contact@korben.info"},
+				{Type: ChangeRemoved, Field: "tag", OldValue: "blog"},
+			},
+			removed: []uint{2, 3, 7},
+		},
+		{
+			name:     "partial crawl",
+			found:    []dbProspectInfo{info(0, "description", "the new one", SourceCrawl)},
+			removals: false,
+			changes:  []CrawlChange{{Type: ChangeAdded, Field: "description", NewValue: "the new one"}},
+		},
+	} {
+		changes, removed := diffInfos(before, test.found, test.removals)
+		assert.Equal(t, test.changes, changes, test.name)
+		assert.Equal(t, test.removed, removed, test.name)
+	}
+}
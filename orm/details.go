@@ -0,0 +1,160 @@
+package orm
+
+// ProspectDetails is a prospect with its informations grouped by kind
+type ProspectDetails struct {
+	Prospect
+	// Infos are all the informations of the prospect, the other fields only keep the most relevant ones
+	Infos       []ProspectInfo
+	Emails      []Email
+	SocialMedia []SocialMedia
+	Assets      Assets
+	Tags        []Tag
+	Description string
+}
+
+// ListDetailed returns a page of prospects with all their informations, the number of queries
+// does not depend on the number of prospects
+func (c *Client) ListDetailed(opts ListOptions) (details []ProspectDetails, total int, err error) {
+	prospects, total, err := c.List(opts)
+	if err != nil {
+		return
+	}
+
+	for _, p := range prospects {
+		details = append(details, p.details())
+	}
+	return
+}
+
+func (c *Client) GetDetailed(prospectId string) (ProspectDetails, error) {
+	p, err := c.Get(prospectId)
+	if err != nil {
+		return ProspectDetails{}, err
+	}
+	return p.details(), nil
+}
+
+// loadInfos fetches the informations of all the prospects in a single query
+func (c *Client) loadInfos(prospects []dbProspect) (list []Prospect, err error) {
+	ids := []string{}
+	for _, prospect := range prospects {
+		ids = append(ids, prospect.ProspectID)
+	}
+
+	infosByProspect := map[string][]dbProspectInfo{}
+	if len(ids) > 0 {
+		allInfos := []dbProspectInfo{}
+		if err = c.Db.Model(&dbProspectInfo{}).
+			Where("prospect_id IN (?) AND NOT rejected", ids).
+			Order("id").
+			Find(&allInfos).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			return
+		}
+		for _, info := range allInfos {
+			infosByProspect[info.ProspectID] = append(infosByProspect[info.ProspectID], info)
+		}
+	}
+
+	for _, prospect := range prospects {
+		list = append(list, Prospect{
+			ProspectId: prospect.ProspectID,
+			prospect:   prospect,
+			infos:      infosByProspect[prospect.ProspectID],
+		})
+	}
+	return
+}
+
+func (p Prospect) details() ProspectDetails {
+	return ProspectDetails{
+		Prospect:    p,
+		Infos:       p.GetInfos(),
+		Emails:      emailsFromInfos(p.infos),
+		SocialMedia: socialMediaFromInfos(p.infos),
+		Assets:      assetsFromInfos(p.infos),
+		Tags:        tagsFromInfos(p.infos),
+		Description: descriptionFromInfos(p.infos),
+	}
+}
+
+func emailsFromInfos(infos []dbProspectInfo) (emails []Email) {
+	for _, info := range infos {
+		if info.Key != "email" {
+			continue
+		}
+		emails = append(emails, Email{
+			InfoID:          info.ID,
+			Email:           info.Val,
+			Confidence:      info.Confidence,
+			ValidatedByUser: info.ValidatedByUser,
+			Source:          info.Source,
+		})
+	}
+	return
+}
+
+// socialMediaFromInfos keeps the most relevant link of each social media, the ones validated by a
+// user always win
+func socialMediaFromInfos(infos []dbProspectInfo) (socialMedias []SocialMedia) {
+	for _, socialMedia := range allSocialMedia {
+		var best *dbProspectInfo
+		for i, info := range infos {
+			if info.Key != socialMedia {
+				continue
+			}
+			if best == nil || isMoreRelevant(info, *best) {
+				best = &infos[i]
+			}
+		}
+		if best == nil {
+			continue
+		}
+		socialMedias = append(socialMedias, SocialMedia{
+			InfoID:          best.ID,
+			Name:            best.Key,
+			Url:             best.Val,
+			Confidence:      best.Confidence,
+			ValidatedByUser: best.ValidatedByUser,
+		})
+	}
+	return
+}
+
+func isMoreRelevant(i, j dbProspectInfo) bool {
+	if i.ValidatedByUser != j.ValidatedByUser {
+		return i.ValidatedByUser
+	}
+	return i.Confidence > j.Confidence
+}
+
+func assetsFromInfos(infos []dbProspectInfo) (assets Assets) {
+	for _, info := range infos {
+		if info.Key != "icon" {
+			continue
+		}
+		assets.Icons = append(assets.Icons, Icon{
+			Link: info.Val,
+		})
+	}
+	return
+}
+
+func tagsFromInfos(infos []dbProspectInfo) (tags []Tag) {
+	for _, info := range infos {
+		if info.Key != "tag" {
+			continue
+		}
+		tags = append(tags, Tag(info.Val))
+	}
+	return
+}
+
+func descriptionFromInfos(infos []dbProspectInfo) string {
+	for _, info := range infos {
+		if info.Key == "description" {
+			return info.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,68 @@
+package orm
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// ProspectEdit is a change of a prospect made by hand, the nil names are left untouched
+type ProspectEdit struct {
+	FirstName  *string
+	MiddleName *string
+	LastName   *string
+	// Remove contains the ids of the informations to remove
+	Remove []uint
+	// RemoveKeys are the kinds of informations removed before Add is saved, e.g the description
+	// to replace it
+	RemoveKeys []string
+	// Add holds the informations entered by hand, see Prospect.SetUserProvided
+	Add *Prospect
+}
+
+// Edit applies the changes of a user to a prospect, all of them or none of them
+func (c *Client) Edit(prospectId string, edit ProspectEdit) error {
+	return c.transaction(func(tx *Client) error {
+		existing := dbProspect{}
+		if err := tx.Db.Model(&dbProspect{}).Where("prospect_id = ?", prospectId).First(&existing).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return ErrProspectNotFound
+			}
+			c.Logger.Warn(err.Error())
+			return err
+		}
+
+		for _, infoId := range edit.Remove {
+			if err := tx.DeleteInfo(prospectId, infoId); err != nil {
+				return err
+			}
+		}
+
+		if edit.FirstName != nil || edit.MiddleName != nil || edit.LastName != nil {
+			firstName, middleName, lastName := existing.FirstName, existing.MiddleName, existing.LastName
+			if edit.FirstName != nil {
+				firstName = *edit.FirstName
+			}
+			if edit.MiddleName != nil {
+				middleName = *edit.MiddleName
+			}
+			if edit.LastName != nil {
+				lastName = *edit.LastName
+			}
+			if err := tx.SetNames(prospectId, firstName, middleName, lastName); err != nil {
+				return err
+			}
+		}
+
+		for _, key := range edit.RemoveKeys {
+			if err := tx.DeleteInfosByKey(prospectId, key); err != nil {
+				return err
+			}
+		}
+
+		if edit.Add == nil {
+			return nil
+		}
+		edit.Add.ProspectId = prospectId
+		edit.Add.prospect = existing
+		return tx.saveInfos(edit.Add)
+	})
+}
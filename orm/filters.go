@@ -0,0 +1,136 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	SortByCreated         = "created"
+	SortByUpdated         = "updated"
+	SortByEmailConfidence = "emailConfidence"
+)
+
+var (
+	ErrUnknownSort          = errors.New("unknown sort, expected one of created, updated, emailConfidence")
+	ErrUnknownSocialNetwork = errors.New("unknown social network, expected one of " + strings.Join(allSocialMedia, ", "))
+)
+
+// ListOptions selects a page of prospects, zero values disable the corresponding filter
+type ListOptions struct {
+	// Limit is the maximum number of prospects returned, 0 means no limit
+	Limit  int
+	Offset int
+
+	HasEmail           bool
+	MinEmailConfidence float64
+	Tag                string
+	SocialNetwork      string
+	// Domain is a substring of the prospect url
+	Domain        string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// ValidatedOnly keeps the prospects having at least one information validated by a user
+	ValidatedOnly bool
+
+	SortBy   string
+	SortDesc bool
+}
+
+func (o ListOptions) Validate() error {
+	switch o.SortBy {
+	case "", SortByCreated, SortByUpdated, SortByEmailConfidence:
+	default:
+		return ErrUnknownSort
+	}
+
+	if o.SocialNetwork != "" && !IsSocialMedia(o.SocialNetwork) {
+		return ErrUnknownSocialNetwork
+	}
+	return nil
+}
+
+func IsSocialMedia(name string) bool {
+	for _, socialMedia := range allSocialMedia {
+		if socialMedia == name {
+			return true
+		}
+	}
+	return false
+}
+
+// filterProspects applies the filters of the options to a query on the prospect table
+func (c *Client) filterProspects(db *gorm.DB, opts ListOptions) *gorm.DB {
+	prospects := c.Db.NewScope(&dbProspect{}).TableName()
+	infos := c.Db.NewScope(&dbProspectInfo{}).TableName()
+
+	// hasInfo matches the prospects having at least one information verifying the condition
+	hasInfo := func(condition string) string {
+		return fmt.Sprintf(`EXISTS (SELECT 1 FROM %s i WHERE i.prospect_id = %s.prospect_id AND i.deleted_at IS NULL AND NOT i.rejected AND %s)`,
+			infos, prospects, condition)
+	}
+
+	if opts.HasEmail || opts.MinEmailConfidence > 0 {
+		db = db.Where(hasInfo("i.key = 'email' AND i.confidence >= ?"), opts.MinEmailConfidence)
+	}
+	if opts.Tag != "" {
+		db = db.Where(hasInfo("i.key = 'tag' AND lower(i.val) = lower(?)"), opts.Tag)
+	}
+	if opts.SocialNetwork != "" {
+		db = db.Where(hasInfo("i.key = ?"), opts.SocialNetwork)
+	}
+	if opts.Domain != "" {
+		db = db.Where(prospects+".url ILIKE ?", "%"+escapeLike(opts.Domain)+"%")
+	}
+	if opts.CreatedAfter != nil {
+		db = db.Where(prospects+".created_at >= ?", *opts.CreatedAfter)
+	}
+	if opts.CreatedBefore != nil {
+		db = db.Where(prospects+".created_at < ?", *opts.CreatedBefore)
+	}
+	if opts.ValidatedOnly {
+		db = db.Where(hasInfo("i.validated_by_user = true"))
+	}
+	return db
+}
+
+func (c *Client) sortProspects(db *gorm.DB, opts ListOptions) *gorm.DB {
+	prospects := c.Db.NewScope(&dbProspect{}).TableName()
+	infos := c.Db.NewScope(&dbProspectInfo{}).TableName()
+
+	direction := "ASC"
+	if opts.SortDesc {
+		direction = "DESC"
+	}
+
+	switch opts.SortBy {
+	case SortByUpdated:
+		db = db.Order(fmt.Sprintf("%s.updated_at %s", prospects, direction))
+	case SortByEmailConfidence:
+		db = db.Order(fmt.Sprintf(`(SELECT MAX(i.confidence) FROM %s i
+			WHERE i.prospect_id = %s.prospect_id AND i.deleted_at IS NULL AND NOT i.rejected AND i.key = 'email') %s NULLS LAST`,
+			infos, prospects, direction))
+	default:
+		db = db.Order(fmt.Sprintf("%s.created_at %s", prospects, direction))
+	}
+	// the id makes the order stable between pages
+	return db.Order(fmt.Sprintf("%s.id %s", prospects, direction))
+}
+
+func paginate(db *gorm.DB, opts ListOptions) *gorm.DB {
+	if opts.Limit > 0 {
+		db = db.Limit(opts.Limit)
+	}
+	if opts.Offset > 0 {
+		db = db.Offset(opts.Offset)
+	}
+	return db
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
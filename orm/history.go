@@ -0,0 +1,162 @@
+package orm
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	ActorCrawl  = "crawl"
+	ActorApiKey = "apikey"
+	ActorUser   = "user"
+	ActorSystem = "system"
+)
+
+const (
+	HistoryCreate   = "create"
+	HistoryUpdate   = "update"
+	HistoryDelete   = "delete"
+	HistoryRestore  = "restore"
+	HistoryValidate = "validate"
+	HistoryReject   = "reject"
+	HistoryPurge    = "purge"
+	// HistoryMerge is recorded on both prospects and on the informations the merge moved or updated,
+	// OldValue is the merged prospect and NewValue the one it was merged into
+	HistoryMerge = "merge"
+)
+
+// Actor is who changes the prospects, e.g the crawl job or the api key of a request
+type Actor struct {
+	Type string
+	ID   string
+	Name string
+}
+
+// dbProspectHistory is append-only, its rows are never updated nor deleted
+type dbProspectHistory struct {
+	ID         uint `gorm:"primary_key"`
+	CreatedAt  time.Time
+	ProspectID string `gorm:"not null;index"`
+	// InfoID is 0 for the changes of the prospect itself
+	InfoID uint
+	Action string `gorm:"not null"`
+	// Field is a prospect field, e.g firstName, or the key of an information, e.g email
+	Field     string
+	OldValue  string `gorm:"type:text"`
+	NewValue  string `gorm:"type:text"`
+	ActorType string `gorm:"not null"`
+	ActorID   string
+	ActorName string
+}
+
+type HistoryEntry struct {
+	ID         uint
+	CreatedAt  time.Time
+	ProspectID string
+	InfoID     uint
+	Action     string
+	Field      string
+	OldValue   string
+	NewValue   string
+	Actor      Actor
+}
+
+// Writer changes the prospects and records the changes in the history, see WithActor
+type Writer interface {
+	Create(p *Prospect) error
+	Save(p *Prospect) error
+	SaveCrawl(p *Prospect, queuedUrl, jobId string, partial bool) (CrawlReport, error)
+	Edit(prospectId string, edit ProspectEdit) error
+	SetNames(prospectId, firstName, middleName, lastName string) error
+	Delete(prospectId string) error
+	Restore(prospectId string) error
+	Merge(targetId, sourceId string) error
+	ValidateInfo(prospectId string, infoId uint) error
+	RejectInfo(prospectId string, infoId uint) error
+	UpdateInfoValue(prospectId string, infoId uint, val string) error
+	DeleteInfo(prospectId string, infoId uint) error
+	DeleteInfosByKey(prospectId, key string) error
+}
+
+// WithActor returns a client recording the changes it makes in the history as done by the actor,
+// the changes are done by the system otherwise
+func (c *Client) WithActor(actor Actor) Writer {
+	client := *c
+	client.actor = actor
+	return &client
+}
+
+// record appends the changes to the history, db is the transaction of the changes if any
+func (c *Client) record(db *gorm.DB, entries ...dbProspectHistory) error {
+	actor := c.actor
+	if actor.Type == "" {
+		actor.Type = ActorSystem
+	}
+
+	for _, entry := range entries {
+		entry.ActorType = actor.Type
+		entry.ActorID = actor.ID
+		entry.ActorName = actor.Name
+		if err := db.Create(&entry).Error; err != nil {
+			c.Logger.Warn("unable to record the history", "prospectId", entry.ProspectID, "err", err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+func infoHistory(info dbProspectInfo, action, oldValue, newValue string) dbProspectHistory {
+	return dbProspectHistory{
+		ProspectID: info.ProspectID,
+		InfoID:     info.ID,
+		Action:     action,
+		Field:      info.Key,
+		OldValue:   oldValue,
+		NewValue:   newValue,
+	}
+}
+
+// GetHistory returns the changes of a prospect, most recent first. The history of a deleted
+// prospect is kept.
+func (c *Client) GetHistory(prospectId string, limit, offset int) (entries []HistoryEntry, total int, err error) {
+	query := c.Db.Model(&dbProspectHistory{}).Where("prospect_id = ?", prospectId)
+	if err = query.Count(&total).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+	if total == 0 {
+		var count int
+		if err = c.Db.Unscoped().Model(&dbProspect{}).Where("prospect_id = ?", prospectId).Count(&count).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			return
+		}
+		if count == 0 {
+			return nil, 0, ErrProspectNotFound
+		}
+	}
+
+	rows := []dbProspectHistory{}
+	if err = query.Order("id DESC").Limit(limit).Offset(offset).Find(&rows).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+	for _, row := range rows {
+		entries = append(entries, HistoryEntry{
+			ID:         row.ID,
+			CreatedAt:  row.CreatedAt,
+			ProspectID: row.ProspectID,
+			InfoID:     row.InfoID,
+			Action:     row.Action,
+			Field:      row.Field,
+			OldValue:   row.OldValue,
+			NewValue:   row.NewValue,
+			Actor: Actor{
+				Type: row.ActorType,
+				ID:   row.ActorID,
+				Name: row.ActorName,
+			},
+		})
+	}
+	return
+}
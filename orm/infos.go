@@ -0,0 +1,191 @@
+package orm
+
+import (
+	"errors"
+
+	"github.com/jinzhu/gorm"
+)
+
+var ErrInfoNotFound = errors.New("prospect information not found")
+
+// ValidateInfo marks an information as right, it is then preferred to the ones found by the crawler
+func (c *Client) ValidateInfo(prospectId string, infoId uint) error {
+	return c.updateInfo(prospectId, infoId, HistoryValidate, map[string]interface{}{
+		"validated_by_user": true,
+		"confidence":        1,
+		"rejected":          false,
+	})
+}
+
+// RejectInfo hides a wrong information, later crawls won't add it again
+func (c *Client) RejectInfo(prospectId string, infoId uint) error {
+	return c.updateInfo(prospectId, infoId, HistoryReject, map[string]interface{}{
+		"validated_by_user": false,
+		"rejected":          true,
+	})
+}
+
+// UpdateInfoValue corrects an information, the new value is considered as validated. The wrong
+// value is kept as rejected so that a later crawl does not add it again.
+func (c *Client) UpdateInfoValue(prospectId string, infoId uint, val string) error {
+	info := dbProspectInfo{}
+	if err := c.Db.Model(&dbProspectInfo{}).Where("id = ? AND prospect_id = ?", infoId, prospectId).First(&info).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return ErrInfoNotFound
+		}
+		c.Logger.Warn(err.Error())
+		return err
+	}
+	if info.Val == val {
+		return c.ValidateInfo(prospectId, infoId)
+	}
+
+	// the corrected value may already be known, e.g found by a crawl or rejected before
+	corrected := dbProspectInfo{}
+	err := c.Db.Model(&dbProspectInfo{}).Where("prospect_id = ? AND key = ? AND val = ?", prospectId, info.Key, val).First(&corrected).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		c.Logger.Warn(err.Error())
+		return err
+	}
+	found := err == nil
+
+	return c.transaction(func(tx *Client) error {
+		if err := tx.Db.Model(&info).Updates(map[string]interface{}{
+			"validated_by_user": false,
+			"rejected":          true,
+		}).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			return err
+		}
+		var err error
+		if found {
+			err = tx.Db.Model(&corrected).Updates(map[string]interface{}{
+				"validated_by_user": true,
+				"confidence":        1,
+				"rejected":          false,
+			}).Error
+		} else {
+			corrected = dbProspectInfo{
+				ProspectID:      prospectId,
+				Key:             info.Key,
+				Val:             val,
+				Confidence:      1,
+				ValidatedByUser: true,
+				Source:          SourceUser,
+			}
+			err = tx.Db.Create(&corrected).Error
+		}
+		if err != nil {
+			c.Logger.Warn(err.Error())
+			return err
+		}
+		if err := tx.record(tx.Db,
+			infoHistory(info, HistoryReject, info.Val, info.Val),
+			infoHistory(corrected, HistoryUpdate, info.Val, val),
+		); err != nil {
+			return err
+		}
+		rejected, validated := toProspectInfo(info), toProspectInfo(corrected)
+		tx.notify(func() {
+			c.Observer.InfoChanged(prospectId, rejected)
+			c.Observer.InfoChanged(prospectId, validated)
+		})
+		return nil
+	})
+}
+
+// DeleteInfo removes an information, unlike RejectInfo a later crawl can find it again
+func (c *Client) DeleteInfo(prospectId string, infoId uint) error {
+	return c.deleteInfos(c.Db.Where("id = ? AND prospect_id = ?", infoId, prospectId), true)
+}
+
+// DeleteInfosByKey removes all the informations of a kind, e.g the description before replacing it
+func (c *Client) DeleteInfosByKey(prospectId, key string) error {
+	return c.deleteInfos(c.Db.Where("prospect_id = ? AND key = ?", prospectId, key), false)
+}
+
+// deleteInfos removes the informations matching the query and records them in the history
+func (c *Client) deleteInfos(query *gorm.DB, mustExist bool) error {
+	infos := []dbProspectInfo{}
+	if err := query.Model(&dbProspectInfo{}).Find(&infos).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return err
+	}
+	if len(infos) == 0 && mustExist {
+		return ErrInfoNotFound
+	}
+
+	return c.transaction(func(tx *Client) error {
+		for _, info := range infos {
+			if err := tx.Db.Delete(&info).Error; err != nil {
+				c.Logger.Warn(err.Error())
+				return err
+			}
+			if err := tx.record(tx.Db, infoHistory(info, HistoryDelete, info.Val, "")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (c *Client) GetInfo(prospectId string, infoId uint) (info ProspectInfo, err error) {
+	dbInfo := dbProspectInfo{}
+	if err = c.Db.Model(&dbProspectInfo{}).
+		Where("id = ? AND prospect_id = ? AND NOT rejected", infoId, prospectId).
+		First(&dbInfo).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return info, ErrInfoNotFound
+		}
+		c.Logger.Warn(err.Error())
+		return
+	}
+	return toProspectInfo(dbInfo), nil
+}
+
+// validateInfo validates an information entered by hand again
+func (c *Client) validateInfo(info dbProspectInfo) error {
+	if err := c.Db.Model(&info).Updates(map[string]interface{}{
+		"validated_by_user": true,
+		"confidence":        1,
+		"rejected":          false,
+	}).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return err
+	}
+	if err := c.record(c.Db, infoHistory(info, HistoryValidate, info.Val, info.Val)); err != nil {
+		return err
+	}
+	validated := toProspectInfo(info)
+	c.notify(func() { c.Observer.InfoChanged(info.ProspectID, validated) })
+	return nil
+}
+
+func (c *Client) updateInfo(prospectId string, infoId uint, action string, values map[string]interface{}) error {
+	info := dbProspectInfo{}
+	if err := c.Db.Model(&dbProspectInfo{}).Where("id = ? AND prospect_id = ?", infoId, prospectId).First(&info).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return ErrInfoNotFound
+		}
+		c.Logger.Warn(err.Error())
+		return err
+	}
+
+	oldValue, newValue := info.Val, info.Val
+	if val, ok := values["val"].(string); ok {
+		newValue = val
+	}
+
+	return c.transaction(func(tx *Client) error {
+		if err := tx.Db.Model(&info).Updates(values).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			return err
+		}
+		if err := tx.record(tx.Db, infoHistory(info, action, oldValue, newValue)); err != nil {
+			return err
+		}
+		changed := toProspectInfo(info)
+		tx.notify(func() { c.Observer.InfoChanged(prospectId, changed) })
+		return nil
+	})
+}
@@ -0,0 +1,233 @@
+package orm
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var ErrMergeItself = errors.New("a prospect cannot be merged into itself")
+
+// dbProspectAlias is the url of a prospect merged into another one, the url is then saved into
+// the prospect it was merged into, e.g when it is crawled again
+type dbProspectAlias struct {
+	ID         uint `gorm:"primary_key"`
+	CreatedAt  time.Time
+	ProspectID string `gorm:"not null;index"`
+	Url        string `gorm:"not null"`
+	DomainKey  string `gorm:"not null;index"`
+}
+
+// findByDomain returns the prospect of a domain, found by its domain key or by one of its aliases
+func (c *Client) findByDomain(domainKey string) (prospect dbProspect, found bool, err error) {
+	err = c.Db.Model(&dbProspect{}).Where("domain_key = ?", domainKey).First(&prospect).Error
+	if err == nil {
+		return prospect, true, nil
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		c.Logger.Warn(err.Error())
+		return
+	}
+
+	alias := dbProspectAlias{}
+	if err = c.Db.Model(&dbProspectAlias{}).Where("domain_key = ?", domainKey).Order("id DESC").First(&alias).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return prospect, false, nil
+		}
+		c.Logger.Warn(err.Error())
+		return
+	}
+	if err = c.Db.Model(&dbProspect{}).Where("prospect_id = ?", alias.ProspectID).First(&prospect).Error; err != nil {
+		// the prospect of the alias is in the trash
+		if gorm.IsRecordNotFoundError(err) {
+			return prospect, false, nil
+		}
+		c.Logger.Warn(err.Error())
+		return
+	}
+	return prospect, true, nil
+}
+
+// addAlias makes the url lead to the prospect, unless its domain already leads to a prospect
+func (c *Client) addAlias(prospectId, url string) error {
+	if canonical, err := CanonicalUrl(url); err == nil {
+		url = canonical
+	}
+	domainKey := DomainKey(url)
+	if _, found, err := c.findByDomain(domainKey); err != nil || found {
+		return err
+	}
+	if err := c.Db.Create(&dbProspectAlias{ProspectID: prospectId, Url: url, DomainKey: domainKey}).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return err
+	}
+	return nil
+}
+
+// Merge moves the informations of source into target, e.g when the blog and the shop of a person
+// are two prospects. The informations both prospects have are kept once with the highest confidence
+// and the flags set by a user. Source is moved to the trash and its url becomes an alias of target.
+func (c *Client) Merge(targetId, sourceId string) error {
+	if targetId == sourceId {
+		return ErrMergeItself
+	}
+	target, source := dbProspect{}, dbProspect{}
+	for _, p := range []struct {
+		id       string
+		prospect *dbProspect
+	}{{targetId, &target}, {sourceId, &source}} {
+		if err := c.Db.Model(&dbProspect{}).Where("prospect_id = ?", p.id).First(p.prospect).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return ErrProspectNotFound
+			}
+			c.Logger.Warn(err.Error())
+			return err
+		}
+	}
+
+	return c.transaction(func(tx *Client) error {
+		changes, err := tx.mergeProspects(tx.Db, target, source)
+		if err != nil {
+			return err
+		}
+		merged, err := tx.Get(targetId)
+		if err != nil {
+			return err
+		}
+		report := CrawlReport{ProspectID: targetId, Changes: changes}
+		tx.notify(func() {
+			c.Observer.ProspectDeleted(sourceId)
+			c.Observer.ProspectChanged(merged, report)
+		})
+		return nil
+	})
+}
+
+// mergeProspects merges source into target in the transaction, see Merge. The changes are the
+// informations and the names target got from source.
+func (c *Client) mergeProspects(transaction *gorm.DB, target, source dbProspect) (changes []CrawlChange, err error) {
+	// reloaded since a previous merge in the transaction may have changed it
+	if err = transaction.Model(&dbProspect{}).Where("prospect_id = ?", target.ProspectID).First(&target).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+
+	targetInfos, sourceInfos := []dbProspectInfo{}, []dbProspectInfo{}
+	if err = transaction.Model(&dbProspectInfo{}).Where("prospect_id = ?", target.ProspectID).Order("id").Find(&targetInfos).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+	if err = transaction.Model(&dbProspectInfo{}).Where("prospect_id = ?", source.ProspectID).Order("id").Find(&sourceInfos).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+
+	now := time.Now()
+	history := []dbProspectHistory{
+		{ProspectID: target.ProspectID, Action: HistoryMerge, OldValue: source.ProspectID, NewValue: target.ProspectID},
+		{ProspectID: source.ProspectID, Action: HistoryMerge, OldValue: source.ProspectID, NewValue: target.ProspectID},
+	}
+	kept := map[[2]string]*dbProspectInfo{}
+	for i := range targetInfos {
+		kept[[2]string{targetInfos[i].Key, targetInfos[i].Val}] = &targetInfos[i]
+	}
+	for i := range sourceInfos {
+		info := &sourceInfos[i]
+		k := [2]string{info.Key, info.Val}
+		existing, found := kept[k]
+		if !found && info.Key != "domain" {
+			// the crawls of target would remove what they do not find on its website
+			if info.Source == SourceCrawl || info.Source == SourceMailto {
+				info.Source = SourceMerge
+			}
+			if err = transaction.Model(&dbProspectInfo{}).Where("id = ?", info.ID).UpdateColumns(map[string]interface{}{
+				"prospect_id": target.ProspectID,
+				"source":      info.Source,
+			}).Error; err != nil {
+				c.Logger.Warn(err.Error())
+				return
+			}
+			info.ProspectID = target.ProspectID
+			kept[k] = info
+			history = append(history, infoHistory(*info, HistoryMerge, source.ProspectID, target.ProspectID))
+			if !info.Rejected {
+				changes = append(changes, CrawlChange{Type: ChangeAdded, Field: info.Key, NewValue: info.Val})
+			}
+			continue
+		}
+
+		if found {
+			merged := mergeInfo(*existing, *info)
+			if merged.Confidence != existing.Confidence || merged.ValidatedByUser != existing.ValidatedByUser || merged.Rejected != existing.Rejected {
+				if err = transaction.Model(&dbProspectInfo{}).Where("id = ?", existing.ID).UpdateColumns(map[string]interface{}{
+					"confidence":        merged.Confidence,
+					"validated_by_user": merged.ValidatedByUser,
+					"rejected":          merged.Rejected,
+				}).Error; err != nil {
+					c.Logger.Warn(err.Error())
+					return
+				}
+				*existing = merged
+				history = append(history, infoHistory(merged, HistoryMerge, source.ProspectID, target.ProspectID))
+			}
+		}
+		// the duplicate stays with source in the trash, so does its domain since target has its own
+		// one and the alias records the url of source
+		if err = transaction.Model(&dbProspectInfo{}).Where("id = ?", info.ID).UpdateColumn("deleted_at", now).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			return
+		}
+		history = append(history, infoHistory(*info, HistoryDelete, info.Val, ""))
+	}
+
+	values := map[string]interface{}{}
+	names := []struct{ column, field, target, source string }{
+		{"first_name", "firstName", target.FirstName, source.FirstName},
+		{"middle_name", "middleName", target.MiddleName, source.MiddleName},
+		{"last_name", "lastName", target.LastName, source.LastName},
+	}
+	for _, name := range names {
+		if name.target == "" && name.source != "" {
+			values[name.column] = name.source
+			history = append(history, dbProspectHistory{ProspectID: target.ProspectID, Action: HistoryUpdate, Field: name.field, NewValue: name.source})
+			changes = append(changes, CrawlChange{Type: ChangeAdded, Field: name.field, NewValue: name.source})
+		}
+	}
+	if source.LastCrawledAt != nil && (target.LastCrawledAt == nil || source.LastCrawledAt.After(*target.LastCrawledAt)) {
+		values["last_crawled_at"] = source.LastCrawledAt
+	}
+	if len(values) > 0 {
+		if err = transaction.Model(&dbProspect{}).Where("prospect_id = ?", target.ProspectID).UpdateColumns(values).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			return
+		}
+	}
+
+	// the aliases of source follow it
+	if err = transaction.Model(&dbProspectAlias{}).Where("prospect_id = ?", source.ProspectID).UpdateColumn("prospect_id", target.ProspectID).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+	if err = transaction.Create(&dbProspectAlias{ProspectID: target.ProspectID, Url: source.Url, DomainKey: source.DomainKey}).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+
+	if err = transaction.Model(&dbProspect{}).Where("prospect_id = ?", source.ProspectID).UpdateColumn("deleted_at", now).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+	err = c.record(transaction, history...)
+	return
+}
+
+// mergeInfo keeps the highest confidence and the flags set by a user, a validation wins over a rejection
+func mergeInfo(i, j dbProspectInfo) dbProspectInfo {
+	if j.Confidence > i.Confidence {
+		i.Confidence = j.Confidence
+	}
+	i.ValidatedByUser = i.ValidatedByUser || j.ValidatedByUser
+	i.Rejected = (i.Rejected || j.Rejected) && !i.ValidatedByUser
+	return i
+}
@@ -0,0 +1,148 @@
+package orm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// migrationLock is the postgresql advisory lock taken while migrating, the servers starting at the
+// same time apply the migrations only once
+const migrationLock = 4246
+
+// dbMigration records the data migrations already applied
+type dbMigration struct {
+	ID        uint   `gorm:"primary_key"`
+	Name      string `gorm:"not null;unique"`
+	CreatedAt time.Time
+}
+
+type migration struct {
+	name  string
+	apply func(c *Client, transaction *gorm.DB) error
+}
+
+// migrations change the existing data once, after the schema is migrated. They are applied in
+// order, a new one is added at the end.
+var migrations = []migration{
+	{name: "canonical-urls", apply: (*Client).canonicalizeUrls},
+}
+
+func (c *Client) migrate() error {
+	for _, m := range migrations {
+		transaction := c.Db.Begin()
+		if err := transaction.Exec("SELECT pg_advisory_xact_lock(?)", migrationLock).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			transaction.Rollback()
+			return err
+		}
+
+		var count int
+		if err := transaction.Model(&dbMigration{}).Where("name = ?", m.name).Count(&count).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			transaction.Rollback()
+			return err
+		}
+		if count > 0 {
+			transaction.Rollback()
+			continue
+		}
+
+		c.Logger.Info("migrating the data", "migration", m.name)
+		if err := m.apply(c, transaction); err != nil {
+			transaction.Rollback()
+			return fmt.Errorf("migration %s failed: %s", m.name, err)
+		}
+		if err := transaction.Create(&dbMigration{Name: m.name}).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			transaction.Rollback()
+			return err
+		}
+		if err := transaction.Commit().Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// canonicalizeUrls gives the prospects and the queued urls saved before CanonicalUrl existed their
+// domain key, then keeps one prospect per domain key
+func (c *Client) canonicalizeUrls(transaction *gorm.DB) error {
+	if err := c.mergeDuplicateDomains(transaction); err != nil {
+		return err
+	}
+	if err := c.setCrawlItemDomainKeys(transaction); err != nil {
+		return err
+	}
+	return c.uniqueDomainKeys(transaction)
+}
+
+// mergeDuplicateDomains canonicalizes the urls saved before CanonicalUrl existed and merges the
+// prospects sharing a domain into the oldest one
+func (c *Client) mergeDuplicateDomains(transaction *gorm.DB) error {
+	prospects := []dbProspect{}
+	if err := transaction.Unscoped().Model(&dbProspect{}).Order("id").Find(&prospects).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return err
+	}
+
+	kept := map[string]dbProspect{}
+	for _, p := range prospects {
+		url := p.Url
+		if canonical, err := CanonicalUrl(p.Url); err == nil {
+			url = canonical
+		}
+		domainKey := DomainKey(url)
+		if url != p.Url || domainKey != p.DomainKey {
+			if err := transaction.Unscoped().Model(&dbProspect{}).
+				Where("id = ?", p.ID).
+				UpdateColumns(map[string]interface{}{"url": url, "domain_key": domainKey}).Error; err != nil {
+				c.Logger.Warn(err.Error())
+				return err
+			}
+			p.Url, p.DomainKey = url, domainKey
+		}
+
+		if p.DeletedAt != nil {
+			continue
+		}
+		target, found := kept[p.DomainKey]
+		if !found {
+			kept[p.DomainKey] = p
+			continue
+		}
+		if _, err := c.mergeProspects(transaction, target, p); err != nil {
+			return err
+		}
+		c.Logger.Info("duplicated prospect merged", "prospectId", p.ProspectID, "into", target.ProspectID)
+	}
+	return nil
+}
+
+// setCrawlItemDomainKeys sets the domain key of the crawl items queued before they had one
+func (c *Client) setCrawlItemDomainKeys(transaction *gorm.DB) error {
+	items := []dbCrawlJobItem{}
+	if err := transaction.Unscoped().Model(&dbCrawlJobItem{}).Where("domain_key IS NULL OR domain_key = ''").Select("id, url").Find(&items).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return err
+	}
+	for _, item := range items {
+		if err := transaction.Unscoped().Model(&dbCrawlJobItem{}).Where("id = ?", item.ID).UpdateColumn("domain_key", DomainKey(item.Url)).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// uniqueDomainKeys prevents two prospects of the same domain from being created at the same time,
+// the duplicates were merged by mergeDuplicateDomains
+func (c *Client) uniqueDomainKeys(transaction *gorm.DB) error {
+	prospects := transaction.NewScope(&dbProspect{}).TableName()
+	if err := transaction.Exec(fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS %[1]s_unique_domain_key ON %[1]s (domain_key) WHERE deleted_at IS NULL`, prospects)).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return err
+	}
+	return nil
+}
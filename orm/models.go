@@ -4,6 +4,7 @@ import (
 	"github.com/bobesa/go-domain-util/domainutil"
 	"github.com/jinzhu/gorm"
 	"strings"
+	"time"
 )
 
 func NewProspect(url string) *Prospect {
@@ -15,15 +16,21 @@ type Prospect struct {
 	ProspectId string
 	prospect   dbProspect
 	infos      []dbProspectInfo
+	// userProvided informations are entered by hand and are considered as validated
+	userProvided bool
 }
 
 type dbProspect struct {
 	gorm.Model
 	ProspectID string `gorm:"not null;unique"`
 	Url        string `gorm:"not null"`
+	// DomainKey is the registrable domain of the url, see DomainKey, there is only one prospect per domain key
+	DomainKey  string `gorm:"index"`
 	FirstName  string
 	MiddleName string
 	LastName   string
+	// LastCrawledAt is when the website was crawled for the last time, nil if it never was
+	LastCrawledAt *time.Time `gorm:"index"`
 }
 
 type dbProspectInfo struct {
@@ -33,6 +40,30 @@ type dbProspectInfo struct {
 	Val             string
 	Confidence      float64 // [0 - 1]
 	ValidatedByUser bool
+	Source          string // where the information comes from, e.g SourceMailto
+	// Rejected informations are wrong according to a user, they are hidden and kept
+	// so that a crawl does not add them again
+	Rejected bool `gorm:"not null;default:false"`
+}
+
+const (
+	SourceCrawl  = "crawl"
+	SourceMailto = "mailto"
+	SourceSmtp   = "smtp"
+	SourceUser   = "user"
+	// SourceMerge informations come from a prospect merged into this one, its crawls do not own them
+	SourceMerge = "merge"
+)
+
+// ProspectInfo is a piece of information about a prospect, Key is e.g "email" or "twitter"
+type ProspectInfo struct {
+	ID              uint
+	Key             string
+	Val             string
+	Confidence      float64
+	ValidatedByUser bool
+	Source          string
+	Rejected        bool
 }
 
 func (i dbProspectInfo) Equal(j dbProspectInfo) bool {
@@ -54,15 +85,54 @@ func (p *Prospect) SetDescription(description string) *Prospect {
 	return p.addInfo("description", description, 1)
 }
 
+// SetUrl saves the canonical form of the url, see CanonicalUrl
 func (p *Prospect) SetUrl(targetUrl string) *Prospect {
+	if canonical, err := CanonicalUrl(targetUrl); err == nil {
+		targetUrl = canonical
+	}
 	p.prospect.Url = targetUrl
+	p.prospect.DomainKey = DomainKey(targetUrl)
 	return p.addInfo("domain", targetUrl, 1)
 }
 
+// replaceUrl moves the prospect and its domain information to another url, e.g the one a crawl was
+// redirected from, without adding another domain information
+func (p *Prospect) replaceUrl(targetUrl string) {
+	p.prospect.Url = targetUrl
+	p.prospect.DomainKey = DomainKey(targetUrl)
+	for i := range p.infos {
+		if p.infos[i].Key == "domain" {
+			p.infos[i].Val = targetUrl
+		}
+	}
+}
+
 func (p *Prospect) GetUrl() string {
 	return p.prospect.Url
 }
 
+func (p *Prospect) GetDomainKey() string {
+	return p.prospect.DomainKey
+}
+
+func (p *Prospect) GetCreatedAt() time.Time {
+	return p.prospect.CreatedAt
+}
+
+func (p *Prospect) GetUpdatedAt() time.Time {
+	return p.prospect.UpdatedAt
+}
+
+func (p *Prospect) GetLastCrawledAt() *time.Time {
+	return p.prospect.LastCrawledAt
+}
+
+// SetCrawledAt records that the website has just been crawled, Save updates the date of a known prospect
+func (p *Prospect) SetCrawledAt(crawledAt time.Time) *Prospect {
+	p.prospect.LastCrawledAt = &crawledAt
+	return p
+}
+
 func (p *Prospect) GetUrlPrefix() string {
 	return strings.Split(p.prospect.Url, "://")[0]
 }
@@ -87,6 +157,10 @@ func (p *Prospect) GetDomain() string {
 // Don't forget to update this slice when a new social media is added
 var allSocialMedia = []string{"facebook", "twitter", "youtube", "google", "linkedin"}
 
+func AllSocialMedia() []string {
+	return append([]string{}, allSocialMedia...)
+}
+
 func (p *Prospect) SetSocial(name, url string, confidence float64) *Prospect {
 	switch name {
 	case "facebook":
@@ -104,7 +178,11 @@ func (p *Prospect) SetSocial(name, url string, confidence float64) *Prospect {
 }
 
 func (p *Prospect) SetEmail(email string, confidence float64) *Prospect {
-	return p.addInfo("email", email, confidence)
+	return p.SetEmailWithSource(email, confidence, SourceCrawl)
+}
+
+func (p *Prospect) SetEmailWithSource(email string, confidence float64, source string) *Prospect {
+	return p.addInfoWithSource("email", email, confidence, source)
 }
 
 func (p *Prospect) SetFirstName(firstName string) *Prospect {
@@ -134,21 +212,58 @@ func (p *Prospect) GetLastName() string {
 	return p.prospect.LastName
 }
 
+// GetInfos returns the informations set on the prospect, duplicates included
+func (p *Prospect) GetInfos() (infos []ProspectInfo) {
+	for _, info := range p.infos {
+		infos = append(infos, toProspectInfo(info))
+	}
+	return
+}
+
+func toProspectInfo(info dbProspectInfo) ProspectInfo {
+	return ProspectInfo{
+		ID:              info.ID,
+		Key:             info.Key,
+		Val:             info.Val,
+		Confidence:      info.Confidence,
+		ValidatedByUser: info.ValidatedByUser,
+		Source:          info.Source,
+		Rejected:        info.Rejected,
+	}
+}
+
 func (p *Prospect) addInfo(key, val string, confidence float64) *Prospect {
+	return p.addInfoWithSource(key, val, confidence, SourceCrawl)
+}
+
+// SetUserProvided flags the informations set afterwards as entered by a user
+func (p *Prospect) SetUserProvided() *Prospect {
+	p.userProvided = true
+	return p
+}
+
+func (p *Prospect) addInfoWithSource(key, val string, confidence float64, source string) *Prospect {
+	validated := false
+	if p.userProvided {
+		source, validated, confidence = SourceUser, true, 1
+	}
 	p.infos = append(p.infos, dbProspectInfo{
 		ProspectID:      p.prospect.ProspectID,
 		Key:             key,
 		Val:             val,
-		ValidatedByUser: false,
+		ValidatedByUser: validated,
 		Confidence:      confidence,
+		Source:          source,
 	})
 	return p
 }
 
 type Email struct {
+	InfoID          uint
 	Email           string
 	Confidence      float64
 	ValidatedByUser bool
+	Source          string
 }
 
 type Assets struct {
@@ -162,6 +277,7 @@ type Icon struct {
 type Tag string
 
 type SocialMedia struct {
+	InfoID          uint
 	Name            string
 	Url             string
 	Confidence      float64
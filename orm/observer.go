@@ -0,0 +1,14 @@
+package orm
+
+// Observer is told about the changes made on the prospects once they are saved, e.g to notify
+// the webhooks
+type Observer interface {
+	ProspectCreated(p Prospect)
+	InfoAdded(p Prospect, info ProspectInfo)
+	ProspectDeleted(prospectId string)
+	// InfoChanged is told when a user validates, rejects or corrects an information
+	InfoChanged(prospectId string, info ProspectInfo)
+	// ProspectChanged is told when a crawl changes a prospect which was already known, or when another
+	// prospect is merged into it, the report then has no id
+	ProspectChanged(p Prospect, report CrawlReport)
+}
@@ -0,0 +1,140 @@
+package orm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RecrawlPolicy tells when the data of a prospect is too old. The age of a tag replaces MaxAge for
+// the prospects having the tag, the shortest one wins when a prospect has several of them. A zero
+// age disables the recrawls it would trigger. A prospect whose website could not be fetched waits
+// RetryDelay before being queued again, twice as long after each partial crawl.
+type RecrawlPolicy struct {
+	MaxAge      time.Duration
+	MaxAgeByTag map[string]time.Duration
+	RetryDelay  time.Duration
+}
+
+func (p RecrawlPolicy) Enabled() bool {
+	if p.MaxAge > 0 {
+		return true
+	}
+	for _, age := range p.MaxAgeByTag {
+		if age > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// StaleCrawlTargets returns at most limit prospects whose last crawl is older than the policy allows,
+// the oldest first. A prospect which has never been crawled is as old as its creation, the ones
+// already waiting in the crawl queue and the ones waiting after a partial crawl are skipped.
+func (c *Client) StaleCrawlTargets(policy RecrawlPolicy, limit int) (targets []CrawlTarget, err error) {
+	if !policy.Enabled() || limit <= 0 {
+		return
+	}
+	prospects := c.Db.NewScope(&dbProspect{}).TableName()
+	infos := c.Db.NewScope(&dbProspectInfo{}).TableName()
+	items := c.Db.NewScope(&dbCrawlJobItem{}).TableName()
+	aliases := c.Db.NewScope(&dbProspectAlias{}).TableName()
+	reports := c.Db.NewScope(&dbCrawlReport{}).TableName()
+
+	lastCrawl := fmt.Sprintf("COALESCE(%[1]s.last_crawled_at, %[1]s.created_at)", prospects)
+	hasTags := fmt.Sprintf(`EXISTS (SELECT 1 FROM %s i WHERE i.prospect_id = %s.prospect_id AND i.deleted_at IS NULL AND NOT i.rejected AND i.key = 'tag' AND lower(i.val) IN (?))`,
+		infos, prospects)
+
+	now := time.Now()
+	conditions, args := []string{}, []interface{}{}
+
+	// sorted so that the query is the same every time
+	ages := map[string]time.Duration{}
+	tags := []string{}
+	for tag, age := range policy.MaxAgeByTag {
+		tag = strings.ToLower(tag)
+		if _, found := ages[tag]; !found {
+			tags = append(tags, tag)
+		}
+		ages[tag] = age
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		if ages[tag] <= 0 {
+			continue
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s AND %s < ?)", hasTags, lastCrawl))
+		args = append(args, []string{tag}, now.Add(-ages[tag]))
+	}
+	if policy.MaxAge > 0 {
+		if len(tags) > 0 {
+			conditions = append(conditions, fmt.Sprintf("(NOT %s AND %s < ?)", hasTags, lastCrawl))
+			args = append(args, tags, now.Add(-policy.MaxAge))
+		} else {
+			conditions = append(conditions, fmt.Sprintf("%s < ?", lastCrawl))
+			args = append(args, now.Add(-policy.MaxAge))
+		}
+	}
+
+	// the queued urls are not canonical, they are compared on the domain of the prospect and of its aliases
+	ofProspect := fmt.Sprintf(`ci.deleted_at IS NULL AND (ci.domain_key = %[1]s.domain_key
+		OR ci.domain_key IN (SELECT a.domain_key FROM %[2]s a WHERE a.prospect_id = %[1]s.prospect_id))`, prospects, aliases)
+	query := c.Db.Model(&dbProspect{}).
+		Where("("+strings.Join(conditions, " OR ")+")", args...).
+		Where(fmt.Sprintf(`NOT EXISTS (SELECT 1 FROM %s ci WHERE %s AND ci.state IN (?))`, items, ofProspect),
+			[]string{CrawlStateQueued, CrawlStateRunning})
+	if policy.RetryDelay > 0 {
+		// a partial crawl could not fetch the website and leaves the last crawl date untouched, the
+		// delay doubles after each partial crawl since the last full one, up to 1024 times
+		query = query.Where(fmt.Sprintf(`NOT EXISTS (SELECT 1 FROM (
+				SELECT count(*) AS failures, max(r.created_at) AS last_failure FROM %s r
+				WHERE r.prospect_id = %s.prospect_id AND r.deleted_at IS NULL AND r.partial AND r.created_at > %s
+			) f WHERE f.failures > 0 AND f.last_failure > ?::timestamptz - make_interval(secs => ?::float8 * power(2, LEAST(f.failures - 1, 10))))`,
+			reports, prospects, lastCrawl),
+			now, policy.RetryDelay.Seconds())
+	}
+
+	dbProspects := []dbProspect{}
+	if err = query.
+		Order(lastCrawl).
+		Limit(limit).
+		Find(&dbProspects).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+	return toCrawlTargets(dbProspects), nil
+}
+
+// CrawlTargetsOf returns what to crawl to refresh the prospects, it fails with ErrProspectNotFound
+// if one of them does not exist
+func (c *Client) CrawlTargetsOf(prospectIds []string) (targets []CrawlTarget, err error) {
+	dbProspects := []dbProspect{}
+	if err = c.Db.Model(&dbProspect{}).Where("prospect_id IN (?)", prospectIds).Order("id").Find(&dbProspects).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+
+	found := map[string]bool{}
+	for _, p := range dbProspects {
+		found[p.ProspectID] = true
+	}
+	for _, id := range prospectIds {
+		if !found[id] {
+			return nil, ErrProspectNotFound
+		}
+	}
+	return toCrawlTargets(dbProspects), nil
+}
+
+func toCrawlTargets(dbProspects []dbProspect) (targets []CrawlTarget) {
+	for _, p := range dbProspects {
+		targets = append(targets, CrawlTarget{
+			Url:        p.Url,
+			FirstName:  p.FirstName,
+			MiddleName: p.MiddleName,
+			LastName:   p.LastName,
+		})
+	}
+	return
+}
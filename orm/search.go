@@ -0,0 +1,190 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// the highlighted words are delimited by control characters in postgresql, they are turned into
+// <mark> tags once the rest of the snippet has been escaped
+const (
+	highlightStart = "\x01"
+	highlightStop  = "\x02"
+)
+
+var ErrEmptySearch = errors.New("the search cannot be empty")
+
+// SearchResult is a prospect matching a full-text search
+type SearchResult struct {
+	ProspectDetails
+	Rank float64
+	// Snippet is html, the matching words are wrapped in <mark> tags
+	Snippet string
+}
+
+type dbSearchResult struct {
+	dbProspect
+	Rank    float64
+	Snippet string
+}
+
+// Search finds the prospects whose url, names, description or tags match the text. The text
+// supports the web search syntax: "quoted phrases", OR and -excluded words. The results are sorted
+// by relevance unless the options ask for another sort.
+func (c *Client) Search(text string, opts ListOptions) (results []SearchResult, total int, err error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, 0, ErrEmptySearch
+	}
+	if err = opts.Validate(); err != nil {
+		return
+	}
+
+	prospects := c.Db.NewScope(&dbProspect{}).TableName()
+	infos := c.Db.NewScope(&dbProspectInfo{}).TableName()
+	language := c.Config.SearchLanguage
+	tsQuery := "websearch_to_tsquery(?::regconfig, ?)"
+
+	query := c.filterProspects(c.Db.Model(&dbProspect{}), opts).
+		Where(fmt.Sprintf("%s.search_vector @@ %s", prospects, tsQuery), language, text)
+	if err = query.Count(&total).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+
+	// the snippet is made from the text since the vector only has the words
+	query = query.Select(fmt.Sprintf(`%[1]s.*,
+		ts_rank(%[1]s.search_vector, %[3]s) AS rank,
+		ts_headline(?::regconfig, %[2]s, %[3]s, ?) AS snippet`, prospects, searchDocument(prospects, infos), tsQuery),
+		language, text,
+		language, language, text,
+		fmt.Sprintf("StartSel=%s, StopSel=%s, MaxFragments=2, MaxWords=20, MinWords=5, FragmentDelimiter=\" … \"", highlightStart, highlightStop))
+	if opts.SortBy == "" {
+		query = query.Order("rank DESC").Order(prospects + ".id")
+	} else {
+		query = c.sortProspects(query, opts)
+	}
+
+	rows := []dbSearchResult{}
+	if err = paginate(query, opts).Scan(&rows).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+
+	dbProspects := []dbProspect{}
+	for _, row := range rows {
+		dbProspects = append(dbProspects, row.dbProspect)
+	}
+	list, err := c.loadInfos(dbProspects)
+	if err != nil {
+		return
+	}
+
+	for i, p := range list {
+		results = append(results, SearchResult{
+			ProspectDetails: p.details(),
+			Rank:            rows[i].Rank,
+			Snippet:         highlight(rows[i].Snippet),
+		})
+	}
+	return
+}
+
+// searchDocument is the text of the prospect row the search looks into, the url is also split on
+// punctuation so that korben matches http://korben.info
+func searchDocument(row, infos string) string {
+	return fmt.Sprintf(`concat_ws(' ', %[1]s.url, regexp_replace(%[1]s.url, '[^[:alnum:]]+', ' ', 'g'),
+		%[1]s.first_name, %[1]s.middle_name, %[1]s.last_name,
+		(SELECT string_agg(i.val, ' ' ORDER BY i.id) FROM %[2]s i
+			WHERE i.prospect_id = %[1]s.prospect_id AND i.deleted_at IS NULL AND NOT i.rejected AND i.key IN ('description', 'tag')))`,
+		row, infos)
+}
+
+// migrateSearch maintains the search_vector column of the prospects with triggers, the words of
+// the prospects are indexed in the configured language. The vectors are computed again when the
+// language changes.
+func (c *Client) migrateSearch() error {
+	prospects := c.Db.NewScope(&dbProspect{}).TableName()
+	infos := c.Db.NewScope(&dbProspectInfo{}).TableName()
+	language := strings.Replace(c.Config.SearchLanguage, "'", "''", -1)
+
+	statements := []string{
+		fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS search_vector tsvector`, prospects),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_search_vector ON %[1]s USING gin (search_vector)`, prospects),
+		fmt.Sprintf(`CREATE OR REPLACE FUNCTION %[1]s_search_vector() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector := to_tsvector('%[2]s'::regconfig, %[3]s);
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql`, prospects, language, searchDocument("NEW", infos)),
+		fmt.Sprintf(`DROP TRIGGER IF EXISTS search_vector ON %s`, prospects),
+		fmt.Sprintf(`CREATE TRIGGER search_vector BEFORE INSERT OR UPDATE ON %[1]s
+	FOR EACH ROW EXECUTE PROCEDURE %[1]s_search_vector()`, prospects),
+		// the update of the prospect computes its vector again
+		fmt.Sprintf(`CREATE OR REPLACE FUNCTION %[1]s_search_vector() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP IN ('UPDATE', 'DELETE') THEN
+		IF OLD.key IN ('description', 'tag') THEN
+			UPDATE %[2]s SET search_vector = NULL WHERE prospect_id = OLD.prospect_id;
+		END IF;
+	END IF;
+	IF TG_OP IN ('INSERT', 'UPDATE') THEN
+		IF NEW.key IN ('description', 'tag') THEN
+			UPDATE %[2]s SET search_vector = NULL WHERE prospect_id = NEW.prospect_id;
+		END IF;
+	END IF;
+	RETURN NULL;
+END
+$$ LANGUAGE plpgsql`, infos, prospects),
+		fmt.Sprintf(`DROP TRIGGER IF EXISTS search_vector ON %s`, infos),
+		fmt.Sprintf(`CREATE TRIGGER search_vector AFTER INSERT OR UPDATE OR DELETE ON %[1]s
+	FOR EACH ROW EXECUTE PROCEDURE %[1]s_search_vector()`, infos),
+	}
+
+	transaction := c.Db.Begin()
+	if err := transaction.Exec("SELECT pg_advisory_xact_lock(?)", migrationLock).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		transaction.Rollback()
+		return err
+	}
+	for _, statement := range statements {
+		if err := transaction.Exec(statement).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			transaction.Rollback()
+			return err
+		}
+	}
+
+	// the language the vectors were computed in is recorded as a migration
+	name := "search-language:" + c.Config.SearchLanguage
+	var count int
+	if err := transaction.Model(&dbMigration{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		transaction.Rollback()
+		return err
+	}
+	if count == 0 {
+		c.Logger.Info("indexing the prospects for the search", "language", c.Config.SearchLanguage)
+		for _, statement := range []string{
+			fmt.Sprintf(`UPDATE %s SET search_vector = NULL`, prospects),
+			fmt.Sprintf(`DELETE FROM %s WHERE name LIKE 'search-language:%%'`, transaction.NewScope(&dbMigration{}).TableName()),
+		} {
+			if err := transaction.Exec(statement).Error; err != nil {
+				c.Logger.Warn(err.Error())
+				transaction.Rollback()
+				return err
+			}
+		}
+		if err := transaction.Create(&dbMigration{Name: name}).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			transaction.Rollback()
+			return err
+		}
+	}
+	return transaction.Commit().Error
+}
+
+func highlight(snippet string) string {
+	return strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>").Replace(html.EscapeString(snippet))
+}
@@ -0,0 +1,155 @@
+package orm
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// TrashedProspect is a deleted prospect with the informations deleted with it
+type TrashedProspect struct {
+	ProspectDetails
+	DeletedAt time.Time
+}
+
+// ListTrash returns a page of the deleted prospects, the most recently deleted first
+func (c *Client) ListTrash(opts ListOptions) (list []TrashedProspect, total int, err error) {
+	query := c.Db.Unscoped().Model(&dbProspect{}).Where("deleted_at IS NOT NULL")
+	if err = query.Count(&total).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+
+	dbProspects := []dbProspect{}
+	if err = paginate(query.Order("deleted_at DESC").Order("id DESC"), opts).Find(&dbProspects).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+
+	ids := []string{}
+	for _, p := range dbProspects {
+		ids = append(ids, p.ProspectID)
+	}
+	infosByProspect := map[string][]dbProspectInfo{}
+	if len(ids) > 0 {
+		allInfos := []dbProspectInfo{}
+		if err = c.Db.Unscoped().Model(&dbProspectInfo{}).
+			Where("prospect_id IN (?) AND deleted_at IS NOT NULL AND NOT rejected", ids).
+			Order("id").
+			Find(&allInfos).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			return
+		}
+		for _, info := range allInfos {
+			infosByProspect[info.ProspectID] = append(infosByProspect[info.ProspectID], info)
+		}
+	}
+
+	for _, dbPro := range dbProspects {
+		// the informations deleted before the prospect are not restored with it
+		infos := []dbProspectInfo{}
+		for _, info := range infosByProspect[dbPro.ProspectID] {
+			if info.DeletedAt.Equal(*dbPro.DeletedAt) {
+				infos = append(infos, info)
+			}
+		}
+		p := Prospect{
+			ProspectId: dbPro.ProspectID,
+			prospect:   dbPro,
+			infos:      infos,
+		}
+		list = append(list, TrashedProspect{
+			ProspectDetails: p.details(),
+			DeletedAt:       *dbPro.DeletedAt,
+		})
+	}
+	return
+}
+
+// Restore brings back a deleted prospect with the informations deleted with it. It fails when
+// another prospect has the same domain, e.g it has been created in the meantime or the deleted
+// prospect was merged into it.
+func (c *Client) Restore(prospectId string) (err error) {
+	dbPro := dbProspect{}
+	if err = c.Db.Unscoped().Model(&dbProspect{}).
+		Where("prospect_id = ? AND deleted_at IS NOT NULL", prospectId).
+		First(&dbPro).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return ErrProspectNotFound
+		}
+		c.Logger.Warn(err.Error())
+		return
+	}
+
+	_, found, err := c.findByDomain(dbPro.DomainKey)
+	if err != nil {
+		return
+	}
+	if found {
+		return ErrProspectAlreadyExists
+	}
+
+	return c.transaction(func(tx *Client) error {
+		if err := tx.Db.Unscoped().Model(&dbProspectInfo{}).
+			Where("prospect_id = ? AND deleted_at = ?", prospectId, dbPro.DeletedAt).
+			UpdateColumn("deleted_at", nil).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			return err
+		}
+		if err := tx.Db.Unscoped().Model(&dbProspect{}).
+			Where("prospect_id = ?", prospectId).
+			UpdateColumn("deleted_at", nil).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			return err
+		}
+		return tx.record(tx.Db, dbProspectHistory{ProspectID: prospectId, Action: HistoryRestore})
+	})
+}
+
+// PurgeTrash permanently removes the prospects deleted before the date with their informations, crawl
+// reports and aliases, the history of the prospects is kept
+func (c *Client) PurgeTrash(deletedBefore time.Time) (purged int64, err error) {
+	err = c.transaction(func(tx *Client) error {
+		if err := tx.Db.Unscoped().Where("deleted_at < ?", deletedBefore).Delete(&dbProspectInfo{}).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			return err
+		}
+		purgedIds := []string{}
+		if err := tx.Db.Unscoped().Model(&dbProspect{}).Where("deleted_at < ?", deletedBefore).Pluck("prospect_id", &purgedIds).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			return err
+		}
+		if len(purgedIds) > 0 {
+			reportIds := []string{}
+			if err := tx.Db.Unscoped().Model(&dbCrawlReport{}).Where("prospect_id IN (?)", purgedIds).Pluck("report_id", &reportIds).Error; err != nil {
+				c.Logger.Warn(err.Error())
+				return err
+			}
+			if err := tx.Db.Where("report_id IN (?)", reportIds).Delete(&dbCrawlChange{}).Error; err != nil {
+				c.Logger.Warn(err.Error())
+				return err
+			}
+			if err := tx.Db.Unscoped().Where("prospect_id IN (?)", purgedIds).Delete(&dbCrawlReport{}).Error; err != nil {
+				c.Logger.Warn(err.Error())
+				return err
+			}
+			if err := tx.Db.Where("prospect_id IN (?)", purgedIds).Delete(&dbProspectAlias{}).Error; err != nil {
+				c.Logger.Warn(err.Error())
+				return err
+			}
+		}
+		res := tx.Db.Unscoped().Where("deleted_at < ?", deletedBefore).Delete(&dbProspect{})
+		if err := res.Error; err != nil {
+			c.Logger.Warn(err.Error())
+			return err
+		}
+		for _, prospectId := range purgedIds {
+			if err := tx.record(tx.Db, dbProspectHistory{ProspectID: prospectId, Action: HistoryPurge}); err != nil {
+				return err
+			}
+		}
+		purged = res.RowsAffected
+		return nil
+	})
+	return
+}
@@ -0,0 +1,324 @@
+package orm
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-plus/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	DeliveryStatePending   = "pending"
+	DeliveryStateDelivered = "delivered"
+	DeliveryStateFailed    = "failed"
+)
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+type dbWebhook struct {
+	gorm.Model
+	WebhookID string `gorm:"not null;unique"`
+	Url       string `gorm:"not null"`
+	// Secret signs the payloads so that the receiver can authenticate them
+	Secret string `gorm:"not null"`
+	// Events is a comma separated list of the events the webhook is subscribed to
+	Events string `gorm:"not null"`
+}
+
+type dbWebhookDelivery struct {
+	gorm.Model
+	DeliveryID     string `gorm:"not null;unique"`
+	WebhookID      string `gorm:"not null;index"`
+	Event          string `gorm:"not null"`
+	Payload        string `gorm:"type:text"`
+	State          string `gorm:"not null"`
+	Attempts       int
+	NextAttemptAt  *time.Time `gorm:"index"`
+	LastStatusCode int
+	LastError      string
+	DeliveredAt    *time.Time
+}
+
+type Webhook struct {
+	WebhookID string
+	Url       string
+	Secret    string
+	Events    []string
+	CreatedAt time.Time
+}
+
+type WebhookDelivery struct {
+	DeliveryID     string
+	WebhookID      string
+	Url            string
+	Secret         string
+	Event          string
+	Payload        string
+	State          string
+	Attempts       int
+	NextAttemptAt  *time.Time
+	LastStatusCode int
+	LastError      string
+	DeliveredAt    *time.Time
+	CreatedAt      time.Time
+}
+
+// Subscribes returns true when the webhook wants to receive the event, "*" subscribes to all of them
+func (w Webhook) Subscribes(event string) bool {
+	for _, e := range w.Events {
+		if e == event || e == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) CreateWebhook(url string, events []string) (webhook Webhook, err error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return
+	}
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return
+	}
+
+	dbHook := dbWebhook{
+		WebhookID: id.String(),
+		Url:       url,
+		Secret:    hex.EncodeToString(secret),
+		Events:    strings.Join(events, ","),
+	}
+	if err = c.Db.Create(&dbHook).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+	return toWebhook(dbHook), nil
+}
+
+func (c *Client) ListWebhooks() (webhooks []Webhook, err error) {
+	dbHooks := []dbWebhook{}
+	if err = c.Db.Model(&dbWebhook{}).Order("id").Find(&dbHooks).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+	for _, dbHook := range dbHooks {
+		webhooks = append(webhooks, toWebhook(dbHook))
+	}
+	return
+}
+
+func (c *Client) GetWebhook(webhookId string) (webhook Webhook, err error) {
+	dbHook := dbWebhook{}
+	if err = c.Db.Model(&dbWebhook{}).Where("webhook_id = ?", webhookId).First(&dbHook).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return webhook, ErrWebhookNotFound
+		}
+		c.Logger.Warn(err.Error())
+		return
+	}
+	return toWebhook(dbHook), nil
+}
+
+// DeleteWebhook removes a webhook, its pending deliveries are abandoned
+func (c *Client) DeleteWebhook(webhookId string) (err error) {
+	transaction := c.Db.Begin()
+	res := transaction.Delete(&dbWebhook{}, "webhook_id = ?", webhookId)
+	if err = res.Error; err != nil {
+		c.Logger.Warn(err.Error())
+		transaction.Rollback()
+		return
+	}
+	if res.RowsAffected == 0 {
+		transaction.Rollback()
+		return ErrWebhookNotFound
+	}
+
+	if err = transaction.Model(&dbWebhookDelivery{}).
+		Where("webhook_id = ? AND state = ?", webhookId, DeliveryStatePending).
+		Updates(map[string]interface{}{
+			"state":      DeliveryStateFailed,
+			"last_error": "webhook deleted",
+		}).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		transaction.Rollback()
+		return
+	}
+	return transaction.Commit().Error
+}
+
+// EnqueueWebhookDeliveries creates a pending delivery of the payload for every webhook subscribed to the event
+func (c *Client) EnqueueWebhookDeliveries(event, payload string) error {
+	webhooks, err := c.ListWebhooks()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, webhook := range webhooks {
+		if !webhook.Subscribes(event) {
+			continue
+		}
+		id, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		if err := c.Db.Create(&dbWebhookDelivery{
+			DeliveryID:    id.String(),
+			WebhookID:     webhook.WebhookID,
+			Event:         event,
+			Payload:       payload,
+			State:         DeliveryStatePending,
+			NextAttemptAt: &now,
+		}).Error; err != nil {
+			c.Logger.Warn(err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// ClaimDueWebhookDeliveries returns the pending deliveries which have to be sent now. They are not
+// due again before the lease expires so that they are sent only once even with several servers.
+func (c *Client) ClaimDueWebhookDeliveries(limit int, lease time.Duration) (deliveries []WebhookDelivery, err error) {
+	now := time.Now()
+	table := c.Db.NewScope(&dbWebhookDelivery{}).TableName()
+
+	rows, err := c.Db.Raw(fmt.Sprintf(`UPDATE %[1]s SET next_attempt_at = ?, updated_at = ?
+		WHERE id IN (
+			SELECT id FROM %[1]s
+			WHERE deleted_at IS NULL AND state = ? AND next_attempt_at <= ?
+			ORDER BY next_attempt_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id`, table),
+		now.Add(lease), now, DeliveryStatePending, now, limit).Rows()
+	if err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+	ids := []uint{}
+	for rows.Next() {
+		var id uint
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if len(ids) == 0 {
+		return
+	}
+
+	dbDeliveries := []dbWebhookDelivery{}
+	if err = c.Db.Model(&dbWebhookDelivery{}).Where("id IN (?)", ids).Order("id").Find(&dbDeliveries).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+	return c.toWebhookDeliveries(dbDeliveries)
+}
+
+// RecordWebhookAttempt saves the outcome of a delivery attempt, a failed attempt is retried at
+// nextAttemptAt unless it is nil
+func (c *Client) RecordWebhookAttempt(deliveryId string, statusCode int, attemptErr error, nextAttemptAt *time.Time) error {
+	now := time.Now()
+	values := map[string]interface{}{
+		"attempts":         gorm.Expr("attempts + 1"),
+		"last_status_code": statusCode,
+		"last_error":       "",
+	}
+	switch {
+	case attemptErr == nil:
+		values["state"] = DeliveryStateDelivered
+		values["delivered_at"] = &now
+	case nextAttemptAt != nil:
+		values["last_error"] = attemptErr.Error()
+		values["next_attempt_at"] = nextAttemptAt
+	default:
+		values["state"] = DeliveryStateFailed
+		values["last_error"] = attemptErr.Error()
+	}
+
+	if err := c.Db.Model(&dbWebhookDelivery{}).
+		Where("delivery_id = ?", deliveryId).
+		Updates(values).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return err
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns the delivery history of a webhook, most recent first
+func (c *Client) ListWebhookDeliveries(webhookId string, limit, offset int) (deliveries []WebhookDelivery, total int, err error) {
+	query := c.Db.Model(&dbWebhookDelivery{}).Where("webhook_id = ?", webhookId)
+	if err = query.Count(&total).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+
+	dbDeliveries := []dbWebhookDelivery{}
+	if err = query.Order("id desc").Limit(limit).Offset(offset).Find(&dbDeliveries).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+	deliveries, err = c.toWebhookDeliveries(dbDeliveries)
+	return
+}
+
+func (c *Client) toWebhookDeliveries(dbDeliveries []dbWebhookDelivery) (deliveries []WebhookDelivery, err error) {
+	webhooks, err := c.listWebhooksUnscoped()
+	if err != nil {
+		return
+	}
+
+	for _, d := range dbDeliveries {
+		webhook := webhooks[d.WebhookID]
+		deliveries = append(deliveries, WebhookDelivery{
+			DeliveryID:     d.DeliveryID,
+			WebhookID:      d.WebhookID,
+			Url:            webhook.Url,
+			Secret:         webhook.Secret,
+			Event:          d.Event,
+			Payload:        d.Payload,
+			State:          d.State,
+			Attempts:       d.Attempts,
+			NextAttemptAt:  d.NextAttemptAt,
+			LastStatusCode: d.LastStatusCode,
+			LastError:      d.LastError,
+			DeliveredAt:    d.DeliveredAt,
+			CreatedAt:      d.CreatedAt,
+		})
+	}
+	return
+}
+
+// listWebhooksUnscoped includes the deleted webhooks, their deliveries are still in the history
+func (c *Client) listWebhooksUnscoped() (webhooks map[string]Webhook, err error) {
+	dbHooks := []dbWebhook{}
+	if err = c.Db.Unscoped().Model(&dbWebhook{}).Find(&dbHooks).Error; err != nil {
+		c.Logger.Warn(err.Error())
+		return
+	}
+	webhooks = map[string]Webhook{}
+	for _, dbHook := range dbHooks {
+		webhooks[dbHook.WebhookID] = toWebhook(dbHook)
+	}
+	return
+}
+
+func toWebhook(dbHook dbWebhook) Webhook {
+	return Webhook{
+		WebhookID: dbHook.WebhookID,
+		Url:       dbHook.Url,
+		Secret:    dbHook.Secret,
+		Events:    strings.Split(dbHook.Events, ","),
+		CreatedAt: dbHook.CreatedAt,
+	}
+}
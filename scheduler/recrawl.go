@@ -0,0 +1,74 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/arthurgustin/openbuzz/orm"
+	"github.com/arthurgustin/openbuzz/shared"
+)
+
+// Recrawler queues the prospects whose data is too old so that the crawl workers refresh them. It
+// only fills the free room of the crawl queue, the recrawls never delay the crawls asked by a user
+// for long.
+type Recrawler struct {
+	DbClient *orm.Client            `inject:""`
+	Logger   shared.LoggerInterface `inject:""`
+	Config   *shared.AppConfig      `inject:""`
+}
+
+func (r *Recrawler) Start() {
+	if !r.policy().Enabled() {
+		r.Logger.Info("the prospects are never recrawled")
+		return
+	}
+	go r.run()
+}
+
+func (r *Recrawler) policy() orm.RecrawlPolicy {
+	return orm.RecrawlPolicy{
+		MaxAge:      r.Config.RecrawlAge,
+		MaxAgeByTag: r.Config.RecrawlTagAges,
+		RetryDelay:  r.Config.RecrawlRetryDelay,
+	}
+}
+
+func (r *Recrawler) run() {
+	for {
+		r.recrawl()
+		time.Sleep(r.Config.RecrawlInterval)
+	}
+}
+
+func (r *Recrawler) recrawl() {
+	limit := r.Config.RecrawlBatchSize
+	if r.Config.CrawlMaxBacklog > 0 {
+		backlog, err := r.DbClient.CrawlBacklog()
+		if err != nil {
+			r.Logger.Warn("unable to read the crawl backlog", "err", err.Error())
+			return
+		}
+		if room := r.Config.CrawlMaxBacklog - backlog.Queued; room < limit {
+			limit = room
+		}
+	}
+	if limit <= 0 {
+		return
+	}
+
+	targets, err := r.DbClient.StaleCrawlTargets(r.policy(), limit)
+	if err != nil {
+		r.Logger.Warn("unable to find the stale prospects", "err", err.Error())
+		return
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	job, err := r.DbClient.CreateCrawlJob(targets)
+	if err != nil {
+		r.Logger.Warn("unable to queue the recrawls", "err", err.Error())
+		return
+	}
+	r.Logger.Info("stale prospects queued", "prospects", fmt.Sprintf("%d", len(targets)), "jobId", job.JobID)
+}
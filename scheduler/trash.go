@@ -0,0 +1,43 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/arthurgustin/openbuzz/orm"
+	"github.com/arthurgustin/openbuzz/shared"
+)
+
+// TrashPurger permanently removes the prospects which have been in the trash for longer than the
+// retention
+type TrashPurger struct {
+	DbClient *orm.Client            `inject:""`
+	Logger   shared.LoggerInterface `inject:""`
+	Config   *shared.AppConfig      `inject:""`
+}
+
+func (p *TrashPurger) Start() {
+	if p.Config.TrashRetention <= 0 {
+		p.Logger.Info("the trash is never purged")
+		return
+	}
+	go p.run()
+}
+
+func (p *TrashPurger) run() {
+	for {
+		p.purge()
+		time.Sleep(p.Config.TrashPurgeInterval)
+	}
+}
+
+func (p *TrashPurger) purge() {
+	purged, err := p.DbClient.PurgeTrash(time.Now().Add(-p.Config.TrashRetention))
+	if err != nil {
+		p.Logger.Warn("unable to purge the trash", "err", err.Error())
+		return
+	}
+	if purged > 0 {
+		p.Logger.Info("trash purged", "prospects", fmt.Sprintf("%d", purged))
+	}
+}
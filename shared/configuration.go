@@ -1,5 +1,7 @@
 package shared
 
+import "time"
+
 type AppConfig struct {
 	PgPort     int    `split_words:"true" default:"5432"`
 	Port       int    `split_words:"true" default:"1346"`
@@ -7,4 +9,35 @@ type AppConfig struct {
 	PgUser     string `split_words:"true" default:"postgres"`
 	PgPassword string `split_words:"true" default:"postgres"`
 	PgDbName   string `split_words:"true" default:"openbuzz"`
+
+	CrawlLeaseDuration time.Duration `split_words:"true" default:"2m"`
+	CrawlMaxAttempts   int           `split_words:"true" default:"3"`
+	CrawlPollInterval  time.Duration `split_words:"true" default:"2s"`
+	CrawlWorkers       int           `split_words:"true" default:"4"`
+	CrawlMaxBacklog    int           `split_words:"true" default:"1000"`
+	SmtpWorkers        int           `split_words:"true" default:"10"`
+
+	AuthDisabled bool `split_words:"true" default:"false"`
+
+	SearchLanguage string `split_words:"true" default:"simple"`
+
+	TrashRetention     time.Duration `split_words:"true" default:"720h"`
+	TrashPurgeInterval time.Duration `split_words:"true" default:"1h"`
+
+	RecrawlAge        time.Duration            `split_words:"true" default:"0"`
+	RecrawlTagAges    map[string]time.Duration `split_words:"true"`
+	RecrawlInterval   time.Duration            `split_words:"true" default:"10m"`
+	RecrawlBatchSize  int                      `split_words:"true" default:"50"`
+	RecrawlRetryDelay time.Duration            `split_words:"true" default:"1h"`
+
+	CorsAllowedOrigins   []string `split_words:"true"`
+	CorsAllowedMethods   []string `split_words:"true" default:"GET,POST,PATCH,DELETE"`
+	CorsAllowedHeaders   []string `split_words:"true" default:"Authorization,Content-Type,X-Api-Key"`
+	CorsAllowCredentials bool     `split_words:"true" default:"false"`
+	CorsMaxAge           int      `split_words:"true" default:"600"`
+	CorsAllowAll         bool     `split_words:"true" default:"false"`
+
+	WebhookMaxAttempts  int           `split_words:"true" default:"8"`
+	WebhookTimeout      time.Duration `split_words:"true" default:"10s"`
+	WebhookPollInterval time.Duration `split_words:"true" default:"5s"`
 }
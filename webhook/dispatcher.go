@@ -0,0 +1,297 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/arthurgustin/openbuzz/orm"
+	"github.com/arthurgustin/openbuzz/shared"
+	"github.com/golang-plus/uuid"
+)
+
+const (
+	EventCrawlFinished   = "crawl.finished"
+	EventCrawlFailed     = "crawl.failed"
+	EventEmailFound      = "email.found"
+	EventProspectCreated = "prospect.created"
+	EventProspectDeleted = "prospect.deleted"
+	EventProspectChanged = "prospect.changed"
+	EventInfoChanged     = "info.changed"
+	// EventAll subscribes a webhook to every event
+	EventAll = "*"
+)
+
+var AllEvents = []string{EventCrawlFinished, EventCrawlFailed, EventEmailFound, EventProspectCreated, EventProspectDeleted, EventProspectChanged, EventInfoChanged}
+
+const (
+	SignatureHeader = "X-Openbuzz-Signature"
+	EventHeader     = "X-Openbuzz-Event"
+	DeliveryHeader  = "X-Openbuzz-Delivery"
+
+	deliveryBatchSize = 20
+	firstRetryDelay   = 30 * time.Second
+	maxRetryDelay     = 6 * time.Hour
+)
+
+func IsEvent(name string) bool {
+	if name == EventAll {
+		return true
+	}
+	for _, event := range AllEvents {
+		if event == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Payload is the json body posted to the webhooks
+type Payload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+type CrawlData struct {
+	JobID  string      `json:"jobId"`
+	Url    string      `json:"url"`
+	Reason string      `json:"reason,omitempty"`
+	Result interface{} `json:"result,omitempty"`
+}
+
+type ProspectData struct {
+	ProspectID string `json:"prospectId"`
+	Url        string `json:"url,omitempty"`
+	FirstName  string `json:"firstName,omitempty"`
+	MiddleName string `json:"middleName,omitempty"`
+	LastName   string `json:"lastName,omitempty"`
+}
+
+type EmailData struct {
+	ProspectID string  `json:"prospectId"`
+	Url        string  `json:"url"`
+	InfoID     uint    `json:"infoId"`
+	Email      string  `json:"email"`
+	Confidence float64 `json:"confidence"`
+	Source     string  `json:"source"`
+}
+
+type InfoData struct {
+	ProspectID      string  `json:"prospectId"`
+	InfoID          uint    `json:"infoId"`
+	Key             string  `json:"key"`
+	Value           string  `json:"value"`
+	Confidence      float64 `json:"confidence"`
+	ValidatedByUser bool    `json:"validatedByUser"`
+	Rejected        bool    `json:"rejected"`
+	Source          string  `json:"source"`
+}
+
+type ChangeData struct {
+	ProspectID string   `json:"prospectId"`
+	Url        string   `json:"url"`
+	ReportID   string   `json:"reportId,omitempty"`
+	JobID      string   `json:"jobId,omitempty"`
+	Changes    []Change `json:"changes"`
+}
+
+type Change struct {
+	Type     string `json:"type"`
+	Field    string `json:"field"`
+	OldValue string `json:"oldValue,omitempty"`
+	NewValue string `json:"newValue,omitempty"`
+}
+
+// Dispatcher stores a delivery for every webhook subscribed to an event and posts them in the
+// background. Failed deliveries are retried with an exponential backoff.
+type Dispatcher struct {
+	DbClient interface {
+		EnqueueWebhookDeliveries(event, payload string) error
+		ClaimDueWebhookDeliveries(limit int, lease time.Duration) ([]orm.WebhookDelivery, error)
+		RecordWebhookAttempt(deliveryId string, statusCode int, attemptErr error, nextAttemptAt *time.Time) error
+	} `inject:""`
+	Logger shared.LoggerInterface `inject:""`
+	Config *shared.AppConfig      `inject:""`
+	// HttpClient posts the payloads, a client with the configured timeout is used when it is nil
+	HttpClient *http.Client
+}
+
+// Sign returns the value of the signature header: the hex encoded HMAC-SHA256 of the body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *Dispatcher) Notify(event string, data interface{}) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		d.Logger.Warn("unable to notify the webhooks", "event", event, "err", err.Error())
+		return
+	}
+	payload, err := json.Marshal(Payload{
+		ID:        id.String(),
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		d.Logger.Warn("unable to notify the webhooks", "event", event, "err", err.Error())
+		return
+	}
+
+	if err := d.DbClient.EnqueueWebhookDeliveries(event, string(payload)); err != nil {
+		d.Logger.Warn("unable to notify the webhooks", "event", event, "err", err.Error())
+	}
+}
+
+func (d *Dispatcher) ProspectCreated(p orm.Prospect) {
+	d.Notify(EventProspectCreated, ProspectData{
+		ProspectID: p.ProspectId,
+		Url:        p.GetUrl(),
+		FirstName:  p.GetFirstName(),
+		MiddleName: p.GetMiddleName(),
+		LastName:   p.GetLastName(),
+	})
+}
+
+func (d *Dispatcher) InfoAdded(p orm.Prospect, info orm.ProspectInfo) {
+	if info.Key != "email" {
+		return
+	}
+	d.Notify(EventEmailFound, EmailData{
+		ProspectID: p.ProspectId,
+		Url:        p.GetUrl(),
+		InfoID:     info.ID,
+		Email:      info.Val,
+		Confidence: info.Confidence,
+		Source:     info.Source,
+	})
+}
+
+func (d *Dispatcher) ProspectDeleted(prospectId string) {
+	d.Notify(EventProspectDeleted, ProspectData{
+		ProspectID: prospectId,
+	})
+}
+
+func (d *Dispatcher) InfoChanged(prospectId string, info orm.ProspectInfo) {
+	d.Notify(EventInfoChanged, InfoData{
+		ProspectID:      prospectId,
+		InfoID:          info.ID,
+		Key:             info.Key,
+		Value:           info.Val,
+		Confidence:      info.Confidence,
+		ValidatedByUser: info.ValidatedByUser,
+		Rejected:        info.Rejected,
+		Source:          info.Source,
+	})
+}
+
+func (d *Dispatcher) ProspectChanged(p orm.Prospect, report orm.CrawlReport) {
+	changes := []Change{}
+	for _, change := range report.Changes {
+		changes = append(changes, Change{
+			Type:     change.Type,
+			Field:    change.Field,
+			OldValue: change.OldValue,
+			NewValue: change.NewValue,
+		})
+	}
+	d.Notify(EventProspectChanged, ChangeData{
+		ProspectID: p.ProspectId,
+		Url:        p.GetUrl(),
+		ReportID:   report.ReportID,
+		JobID:      report.JobID,
+		Changes:    changes,
+	})
+}
+
+func (d *Dispatcher) Start() {
+	if d.HttpClient == nil {
+		d.HttpClient = &http.Client{Timeout: d.Config.WebhookTimeout}
+	}
+	d.Logger.Info("starting webhook deliveries")
+	go d.run()
+}
+
+func (d *Dispatcher) run() {
+	for {
+		// a delivery is not claimed again while it is being sent
+		deliveries, err := d.DbClient.ClaimDueWebhookDeliveries(deliveryBatchSize, deliveryBatchSize*d.Config.WebhookTimeout)
+		if err != nil {
+			d.Logger.Warn("unable to claim the webhook deliveries", "err", err.Error())
+		}
+		if len(deliveries) == 0 {
+			time.Sleep(d.Config.WebhookPollInterval)
+			continue
+		}
+
+		for _, delivery := range deliveries {
+			d.deliver(delivery)
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(delivery orm.WebhookDelivery) {
+	statusCode, err := d.send(delivery)
+
+	var nextAttemptAt *time.Time
+	if err != nil {
+		d.Logger.Warn("webhook delivery failed", "deliveryId", delivery.DeliveryID, "url", delivery.Url, "err", err.Error())
+		if attempts := delivery.Attempts + 1; attempts < d.Config.WebhookMaxAttempts {
+			next := time.Now().Add(retryDelay(attempts))
+			nextAttemptAt = &next
+		}
+	}
+
+	if err := d.DbClient.RecordWebhookAttempt(delivery.DeliveryID, statusCode, err, nextAttemptAt); err != nil {
+		d.Logger.Warn("unable to save the webhook delivery", "deliveryId", delivery.DeliveryID, "err", err.Error())
+	}
+}
+
+// send posts the payload, any status outside of 2xx is a failure
+func (d *Dispatcher) send(delivery orm.WebhookDelivery) (statusCode int, err error) {
+	req, err := http.NewRequest(http.MethodPost, delivery.Url, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "openbuzz-webhook")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.DeliveryID)
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, []byte(delivery.Payload)))
+
+	resp, err := d.HttpClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryDelay doubles after each attempt: 30s, 1m, 2m, 4m... up to 6h
+func retryDelay(attempts int) time.Duration {
+	delay := firstRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,158 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arthurgustin/openbuzz/orm"
+	"github.com/arthurgustin/openbuzz/shared"
+	"github.com/stretchr/testify/assert"
+)
+
+type attempt struct {
+	deliveryId    string
+	statusCode    int
+	err           error
+	nextAttemptAt *time.Time
+}
+
+// fakeDbClient records the attempts instead of saving them
+type fakeDbClient struct {
+	attempts []attempt
+}
+
+func (c *fakeDbClient) EnqueueWebhookDeliveries(event, payload string) error {
+	return nil
+}
+
+func (c *fakeDbClient) ClaimDueWebhookDeliveries(limit int, lease time.Duration) ([]orm.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (c *fakeDbClient) RecordWebhookAttempt(deliveryId string, statusCode int, attemptErr error, nextAttemptAt *time.Time) error {
+	c.attempts = append(c.attempts, attempt{deliveryId, statusCode, attemptErr, nextAttemptAt})
+	return nil
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Info(message string, fields ...string)  {}
+func (nopLogger) Warn(message string, fields ...string)  {}
+func (nopLogger) Fatal(message string, fields ...string) {}
+
+func newTestDispatcher(maxAttempts int) (*Dispatcher, *fakeDbClient) {
+	db := &fakeDbClient{}
+	return &Dispatcher{
+		DbClient:   db,
+		Logger:     nopLogger{},
+		Config:     &shared.AppConfig{WebhookMaxAttempts: maxAttempts},
+		HttpClient: &http.Client{Timeout: time.Second},
+	}, db
+}
+
+func newDelivery(url string, attempts int) orm.WebhookDelivery {
+	return orm.WebhookDelivery{
+		DeliveryID: "delivery-1",
+		Url:        url,
+		Secret:     "secret",
+		Event:      EventProspectCreated,
+		Payload:    `{"event":"prospect.created"}`,
+		Attempts:   attempts,
+	}
+}
+
+func TestDeliverSignsThePayload(t *testing.T) {
+	var received *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	d, db := newTestDispatcher(8)
+	d.deliver(newDelivery(server.URL, 0))
+
+	if assert.NotNil(t, received) {
+		assert.Equal(t, http.MethodPost, received.Method)
+		assert.Equal(t, `{"event":"prospect.created"}`, string(body))
+		assert.Equal(t, Sign("secret", body), received.Header.Get(SignatureHeader))
+		assert.Equal(t, EventProspectCreated, received.Header.Get(EventHeader))
+		assert.Equal(t, "delivery-1", received.Header.Get(DeliveryHeader))
+	}
+	if assert.Len(t, db.attempts, 1) {
+		assert.Equal(t, http.StatusNoContent, db.attempts[0].statusCode)
+		assert.NoError(t, db.attempts[0].err)
+		assert.Nil(t, db.attempts[0].nextAttemptAt)
+	}
+}
+
+func TestSign(t *testing.T) {
+	// echo -n 'payload' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=b82fcb791acec57859b989b430a826488ce2e479fdf92326bd0a2e8375a42ba4", Sign("secret", []byte("payload")))
+}
+
+func TestDeliverRetriesServerErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	d, db := newTestDispatcher(8)
+	for _, previousAttempts := range []int{0, 1, 2} {
+		before := time.Now()
+		d.deliver(newDelivery(server.URL, previousAttempts))
+
+		last := db.attempts[len(db.attempts)-1]
+		assert.Equal(t, http.StatusServiceUnavailable, last.statusCode)
+		assert.Error(t, last.err)
+		if assert.NotNil(t, last.nextAttemptAt) {
+			// 30s, 1m then 2m
+			expected := before.Add(firstRetryDelay << uint(previousAttempts))
+			assert.WithinDuration(t, expected, *last.nextAttemptAt, 5*time.Second)
+		}
+	}
+}
+
+func TestDeliverGivesUpAfterMaxAttempts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	d, db := newTestDispatcher(3)
+	d.deliver(newDelivery(server.URL, 1))
+	d.deliver(newDelivery(server.URL, 2))
+
+	if assert.Len(t, db.attempts, 2) {
+		assert.NotNil(t, db.attempts[0].nextAttemptAt)
+		assert.Error(t, db.attempts[1].err)
+		assert.Nil(t, db.attempts[1].nextAttemptAt, "the third attempt is the last one")
+	}
+}
+
+func TestDeliverRetriesUnreachableWebhooks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	d, db := newTestDispatcher(8)
+	d.deliver(newDelivery(url, 0))
+
+	if assert.Len(t, db.attempts, 1) {
+		assert.Equal(t, 0, db.attempts[0].statusCode)
+		assert.Error(t, db.attempts[0].err)
+		assert.NotNil(t, db.attempts[0].nextAttemptAt)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, 30*time.Second, retryDelay(1))
+	assert.Equal(t, time.Minute, retryDelay(2))
+	assert.Equal(t, 4*time.Minute, retryDelay(4))
+	assert.Equal(t, maxRetryDelay, retryDelay(20))
+}